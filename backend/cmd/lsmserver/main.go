@@ -35,6 +35,12 @@ func main() {
 	r.HandleFunc("/get/{key}", server.HandleGet).Methods("GET")
 	r.HandleFunc("/put", server.HandlePut).Methods("POST")
 	r.HandleFunc("/delete/{key}", server.HandleDelete).Methods("DELETE")
+	r.HandleFunc("/scan", server.HandleScan).Methods("GET")
+	r.HandleFunc("/admin/compact", server.HandleCompact).Methods("POST")
+	r.HandleFunc("/admin/compact", server.HandleCompactStatus).Methods("GET")
+	r.HandleFunc("/admin/sstables", server.HandleSSTables).Methods("GET")
+	r.HandleFunc("/admin/cache", server.HandleBlockCache).Methods("GET")
+	r.HandleFunc("/admin/row-cache", server.HandleRowCache).Methods("GET")
 
 	go func() {
 		log.Println("Starting Server on :8080")
@@ -2,4 +2,4 @@ module github.com/ashmitsharp/lsm-tree/backend
 
 go 1.22.5
 
-require github.com/gorilla/mux v1.8.1 // indirect
+require github.com/gorilla/mux v1.8.1
@@ -3,13 +3,16 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"sync"
 
 	"github.com/ashmitsharp/lsm-tree/backend/internal/lsm"
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	lsmTree *lsm.LSMTree
+	lsmTree    *lsm.LSMTree
+	compacting sync.Mutex
 }
 
 func NewServer(lsmTree *lsm.LSMTree) *Server {
@@ -20,7 +23,11 @@ func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 
-	value, found := s.lsmTree.Get(key)
+	value, found, err := s.lsmTree.Get(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	if !found {
 		http.Error(w, "Key not found", http.StatusNotFound)
 		return
@@ -65,3 +72,92 @@ func (s *Server) HandleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+type scanResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// HandleScan returns the key-value pairs in [start, end) that begin with
+// prefix, all of which are optional query parameters, up to limit pairs.
+func (s *Server) HandleScan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := -1
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	it := s.lsmTree.NewIterator(lsm.IteratorOptions{
+		Start:  query.Get("start"),
+		End:    query.Get("end"),
+		Prefix: query.Get("prefix"),
+	})
+	defer it.Close()
+
+	results := []scanResult{}
+	for ; it.Valid() && limit != 0; it.Next() {
+		results = append(results, scanResult{Key: it.Key(), Value: it.Value()})
+		limit--
+	}
+	if err := it.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+type compactRequest struct {
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	MaxJobs int    `json:"max_jobs"`
+}
+
+// HandleCompact starts a manual compaction of a key range in the background.
+// Progress is reported by HandleCompactStatus.
+func (s *Server) HandleCompact(w http.ResponseWriter, r *http.Request) {
+	var req compactRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !s.compacting.TryLock() {
+		http.Error(w, "Compaction already running", http.StatusConflict)
+		return
+	}
+
+	go func() {
+		defer s.compacting.Unlock()
+		s.lsmTree.CompactRange(req.Start, req.End, req.MaxJobs)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(req)
+}
+
+func (s *Server) HandleCompactStatus(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.lsmTree.CompactionProgress())
+}
+
+// HandleSSTables lists the live SSTables with their stored properties.
+func (s *Server) HandleSSTables(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.lsmTree.TableProperties())
+}
+
+// HandleBlockCache reports the block cache's usage and hit rate.
+func (s *Server) HandleBlockCache(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.lsmTree.BlockCacheStats())
+}
+
+// HandleRowCache reports the row cache's usage and hit rate.
+func (s *Server) HandleRowCache(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.lsmTree.RowCacheStats())
+}
@@ -0,0 +1,179 @@
+package cache
+
+import "sync"
+
+// Policy chooses which unpinned entry a full cache evicts.
+type Policy int
+
+const (
+	// LRU evicts the entry released longest ago.
+	LRU Policy = iota
+	// Clock approximates LRU with a reference bit per entry, which is
+	// cheaper to maintain on hits: entries are swept in a ring and only
+	// evicted once they have not been used since the last sweep.
+	Clock
+)
+
+// The cache is split into up to maxShards shards so concurrent lookups
+// rarely contend on the same mutex. Each shard holds an equal part of the
+// capacity and at least minShardCapacity, so that small caches are not cut
+// into parts too small to hold a few blocks each.
+const (
+	maxShards        = 16
+	minShardCapacity = 512 << 10
+)
+
+// Stats reports the cache's usage and how effective it has been.
+type Stats struct {
+	Capacity int64
+	// Usage includes PinnedUsage and memory charged from outside the cache.
+	Usage       int64
+	PinnedUsage int64
+	Charged     int64
+	Entries     int
+	Hits        int64
+	Misses      int64
+	Inserts     int64
+	Evictions   int64
+}
+
+// Cache is a sharded cache of a fixed capacity in bytes, meant to be shared
+// by every table of every store in a process.
+//
+// Lookups and inserts return a Handle that pins the entry: pinned entries
+// count against the capacity but are not evicted until every handle to them
+// is released. The cache may go over capacity while too much is pinned.
+//
+// Cache implements memtable.CacheCharger, so memtable memory can be charged
+// to it and cached blocks give way to memtables under one memory budget.
+type Cache struct {
+	shards   []*shard
+	capacity int64
+	charged  int64
+	nextID   uint64
+	mutex    sync.Mutex
+}
+
+func NewCache(capacity int64, policy Policy) *Cache {
+	numShards := 1
+	for numShards < maxShards && capacity/int64(2*numShards) >= minShardCapacity {
+		numShards *= 2
+	}
+	c := &Cache{capacity: capacity, shards: make([]*shard, numShards)}
+	for i := range c.shards {
+		c.shards[i] = newShard(c, policy)
+	}
+	return c
+}
+
+// NewID returns a number unique within the cache, which users put in their
+// keys to keep them apart from those of other users sharing the cache.
+func (c *Cache) NewID() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.nextID++
+	return c.nextID
+}
+
+// Lookup returns a handle to the entry for key, or nil if it is not cached.
+func (c *Cache) Lookup(key string) *Handle {
+	return c.shardFor(key).lookup(key)
+}
+
+// Insert adds value under key, replacing any entry already there, and
+// returns a handle to it. charge is the memory it accounts for.
+func (c *Cache) Insert(key string, value interface{}, charge int64) *Handle {
+	return c.shardFor(key).insert(key, value, charge)
+}
+
+// Erase removes the entry for key. If it is pinned, its memory is only
+// given back once the last handle is released.
+func (c *Cache) Erase(key string) {
+	c.shardFor(key).erase(key)
+}
+
+// Charge accounts for n bytes held outside the cache, evicting entries to
+// make room for them.
+func (c *Cache) Charge(n int64) {
+	c.mutex.Lock()
+	c.charged += n
+	c.mutex.Unlock()
+
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		s.evict()
+		s.mutex.Unlock()
+	}
+}
+
+// Release gives back n bytes previously passed to Charge.
+func (c *Cache) Release(n int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.charged -= n
+	if c.charged < 0 {
+		c.charged = 0
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	c.mutex.Lock()
+	stats := Stats{Capacity: c.capacity, Charged: c.charged}
+	c.mutex.Unlock()
+
+	stats.Usage = stats.Charged
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		stats.Usage += s.usage
+		stats.PinnedUsage += s.pinnedUsage
+		stats.Entries += len(s.entries)
+		stats.Hits += s.hits
+		stats.Misses += s.misses
+		stats.Inserts += s.inserts
+		stats.Evictions += s.evictions
+		s.mutex.Unlock()
+	}
+	return stats
+}
+
+// shardCapacity is the part of the capacity left to each shard once memory
+// charged from outside is taken out.
+func (c *Cache) shardCapacity() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return (c.capacity - c.charged) / int64(len(c.shards))
+}
+
+func (c *Cache) shardFor(key string) *shard {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+// Handle keeps a cache entry pinned until it is released.
+type Handle struct {
+	shard *shard
+	entry *entry
+}
+
+func (h *Handle) Key() string {
+	return h.entry.key
+}
+
+func (h *Handle) Value() interface{} {
+	return h.entry.value
+}
+
+// Release unpins the entry. It is safe to call on a nil handle, and calls
+// after the first do nothing.
+func (h *Handle) Release() {
+	if h == nil || h.shard == nil {
+		return
+	}
+	h.shard.release(h.entry)
+	h.shard = nil
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+// insert adds an unpinned entry.
+func insert(c *Cache, key string, charge int64) {
+	c.Insert(key, key, charge).Release()
+}
+
+func cached(c *Cache, key string) bool {
+	h := c.Lookup(key)
+	defer h.Release()
+	return h != nil
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(100, LRU)
+	insert(c, "a", 40)
+	insert(c, "b", 40)
+	if !cached(c, "a") {
+		t.Fatal("a is missing")
+	}
+	insert(c, "c", 40)
+
+	if cached(c, "b") {
+		t.Fatal("b was used least recently but not evicted")
+	}
+	if !cached(c, "a") || !cached(c, "c") {
+		t.Fatal("recently used entries were evicted")
+	}
+	if stats := c.Stats(); stats.Usage != 80 || stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestPinnedEntriesAreNotEvicted(t *testing.T) {
+	for _, policy := range []Policy{LRU, Clock} {
+		t.Run(fmt.Sprint(policy), func(t *testing.T) {
+			c := NewCache(100, policy)
+			a := c.Insert("a", "a", 60)
+			b := c.Insert("b", "b", 60)
+			if stats := c.Stats(); stats.Usage != 120 || stats.PinnedUsage != 120 {
+				t.Fatalf("stats %+v with both entries pinned", stats)
+			}
+			if a.Value() != "a" || !cached(c, "a") || !cached(c, "b") {
+				t.Fatal("pinned entries were evicted")
+			}
+
+			// Once unpinned, the cache shrinks back to its capacity.
+			a.Release()
+			a.Release()
+			b.Release()
+			if stats := c.Stats(); stats.Usage > 100 || stats.PinnedUsage != 0 || stats.Entries != 1 {
+				t.Fatalf("stats %+v after releasing every entry", stats)
+			}
+		})
+	}
+}
+
+func TestEraseKeepsPinnedMemoryUntilReleased(t *testing.T) {
+	c := NewCache(100, LRU)
+	h := c.Insert("a", "a", 30)
+	c.Erase("a")
+	if cached(c, "a") {
+		t.Fatal("erased entry is still cached")
+	}
+	if stats := c.Stats(); stats.Usage != 30 {
+		t.Fatalf("usage %d while the erased entry is pinned, want 30", stats.Usage)
+	}
+	if h.Value() != "a" {
+		t.Fatal("handle lost its value when the entry was erased")
+	}
+	h.Release()
+	if stats := c.Stats(); stats.Usage != 0 {
+		t.Fatalf("usage %d after releasing the erased entry, want 0", stats.Usage)
+	}
+
+	// Replacing an entry works the same way.
+	old := c.Insert("b", "old", 30)
+	insert(c, "b", 20)
+	if stats := c.Stats(); stats.Usage != 50 {
+		t.Fatalf("usage %d while the replaced entry is pinned, want 50", stats.Usage)
+	}
+	old.Release()
+	if stats := c.Stats(); stats.Usage != 20 || stats.Entries != 1 {
+		t.Fatalf("stats %+v after releasing the replaced entry", stats)
+	}
+}
+
+func TestChargeEvictsEntries(t *testing.T) {
+	c := NewCache(100, LRU)
+	insert(c, "a", 40)
+	insert(c, "b", 40)
+	c.Charge(50)
+	if stats := c.Stats(); stats.Entries != 1 || stats.Usage != 90 || stats.Charged != 50 {
+		t.Fatalf("stats %+v after charging memory held outside", stats)
+	}
+	if cached(c, "a") || !cached(c, "b") {
+		t.Fatal("charging did not evict the least recently used entry")
+	}
+
+	c.Release(50)
+	insert(c, "c", 40)
+	if !cached(c, "b") || !cached(c, "c") {
+		t.Fatal("released memory is not available to the cache")
+	}
+}
+
+func TestClockGivesReferencedEntriesASecondChance(t *testing.T) {
+	c := NewCache(100, Clock)
+	insert(c, "a", 30)
+	insert(c, "b", 30)
+	insert(c, "c", 30)
+	// The hand clears every reference bit and evicts the first entry.
+	insert(c, "d", 30)
+	if cached(c, "a") {
+		t.Fatal("a was not evicted")
+	}
+
+	// b and c have lost their reference bits; a lookup gives c it back.
+	if !cached(c, "c") {
+		t.Fatal("c is missing")
+	}
+	insert(c, "e", 30)
+	if cached(c, "b") {
+		t.Fatal("b was not evicted")
+	}
+	if !cached(c, "c") || !cached(c, "d") || !cached(c, "e") {
+		t.Fatal("a referenced entry was evicted")
+	}
+}
+
+func TestLookupStats(t *testing.T) {
+	c := NewCache(100, LRU)
+	insert(c, "a", 10)
+	cached(c, "a")
+	cached(c, "a")
+	cached(c, "b")
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Inserts != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if a, b := c.NewID(), c.NewID(); a == b {
+		t.Fatalf("IDs %d and %d are not unique", a, b)
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+// lruPolicy keeps unpinned entries in a list ordered by release time. An
+// entry is taken off the list while pinned, so a lookup followed by a
+// release moves it to the front.
+type lruPolicy struct {
+	head entry
+}
+
+func newLRUPolicy() *lruPolicy {
+	p := &lruPolicy{}
+	p.head.prev, p.head.next = &p.head, &p.head
+	return p
+}
+
+func (p *lruPolicy) add(e *entry) {
+	e.prev, e.next = &p.head, p.head.next
+	e.prev.next, e.next.prev = e, e
+}
+
+func (p *lruPolicy) remove(e *entry) {
+	e.prev.next, e.next.prev = e.next, e.prev
+	e.prev, e.next = nil, nil
+}
+
+func (p *lruPolicy) victim() *entry {
+	if p.head.prev == &p.head {
+		return nil
+	}
+	return p.head.prev
+}
+
+// clockPolicy keeps unpinned entries in a ring swept by a hand. Entries come
+// back from being pinned with their reference bit set, and the hand clears
+// the bit on its first pass and evicts on its second.
+type clockPolicy struct {
+	ring []*entry
+	hand int
+}
+
+func (p *clockPolicy) add(e *entry) {
+	e.referenced = true
+	e.position = len(p.ring)
+	p.ring = append(p.ring, e)
+}
+
+func (p *clockPolicy) remove(e *entry) {
+	last := p.ring[len(p.ring)-1]
+	p.ring[e.position] = last
+	last.position = e.position
+	p.ring = p.ring[:len(p.ring)-1]
+}
+
+func (p *clockPolicy) victim() *entry {
+	for len(p.ring) > 0 {
+		if p.hand >= len(p.ring) {
+			p.hand = 0
+		}
+		e := p.ring[p.hand]
+		if !e.referenced {
+			return e
+		}
+		e.referenced = false
+		p.hand++
+	}
+	return nil
+}
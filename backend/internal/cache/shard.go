@@ -0,0 +1,138 @@
+package cache
+
+import "sync"
+
+type entry struct {
+	key    string
+	value  interface{}
+	charge int64
+	refs   int
+	// inCache is false once the entry is replaced or erased while pinned;
+	// it is then freed when the last handle is released.
+	inCache bool
+
+	// Eviction policy state.
+	prev, next *entry
+	referenced bool
+	position   int
+}
+
+// evictionPolicy tracks the entries that may be evicted, which are those in
+// the cache that nobody holds a handle to.
+type evictionPolicy interface {
+	add(e *entry)
+	remove(e *entry)
+	// victim returns the entry to evict next, or nil if there is none.
+	victim() *entry
+}
+
+type shard struct {
+	cache       *Cache
+	entries     map[string]*entry
+	policy      evictionPolicy
+	usage       int64
+	pinnedUsage int64
+	hits        int64
+	misses      int64
+	inserts     int64
+	evictions   int64
+	mutex       sync.Mutex
+}
+
+func newShard(c *Cache, policy Policy) *shard {
+	s := &shard{cache: c, entries: make(map[string]*entry)}
+	if policy == Clock {
+		s.policy = &clockPolicy{}
+	} else {
+		s.policy = newLRUPolicy()
+	}
+	return s
+}
+
+func (s *shard) lookup(key string) *Handle {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		s.misses++
+		return nil
+	}
+	s.hits++
+	s.pin(e)
+	return &Handle{shard: s, entry: e}
+}
+
+func (s *shard) insert(key string, value interface{}, charge int64) *Handle {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.entries[key]; ok {
+		s.detach(old)
+	}
+	e := &entry{key: key, value: value, charge: charge, refs: 1, inCache: true}
+	s.entries[key] = e
+	s.usage += charge
+	s.pinnedUsage += charge
+	s.inserts++
+	s.evict()
+	return &Handle{shard: s, entry: e}
+}
+
+func (s *shard) erase(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.detach(e)
+	}
+}
+
+func (s *shard) release(e *entry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e.refs--
+	if e.refs > 0 {
+		return
+	}
+	s.pinnedUsage -= e.charge
+	if !e.inCache {
+		s.usage -= e.charge
+		return
+	}
+	s.policy.add(e)
+	s.evict()
+}
+
+func (s *shard) pin(e *entry) {
+	if e.refs == 0 {
+		s.policy.remove(e)
+		s.pinnedUsage += e.charge
+	}
+	e.refs++
+}
+
+// detach removes e from the cache. Its memory stays accounted for until it
+// is unpinned.
+func (s *shard) detach(e *entry) {
+	delete(s.entries, e.key)
+	e.inCache = false
+	if e.refs == 0 {
+		s.policy.remove(e)
+		s.usage -= e.charge
+	}
+}
+
+// evict drops unpinned entries until the shard fits its capacity.
+func (s *shard) evict() {
+	capacity := s.cache.shardCapacity()
+	for s.usage > capacity {
+		e := s.policy.victim()
+		if e == nil {
+			return
+		}
+		s.detach(e)
+		s.evictions++
+	}
+}
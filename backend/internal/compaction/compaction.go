@@ -2,39 +2,59 @@ package compaction
 
 import (
 	"container/heap"
+	"math"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/ashmitsharp/lsm-tree/backend/internal/diskspace"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/ratelimit"
 	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
 )
 
 type Compactor struct {
-	sstableManager *sstable.SSTableManager
-	mutex          sync.Mutex
-	stopChan       chan struct{}
-	minThreshold   int
-	gcBefore       int64
+	sstableManager  *sstable.SSTableManager
+	opts            Options
+	compactPointers []string
+	mutex           sync.Mutex
+	stopChan        chan struct{}
+	doneChan        chan struct{}
+	notifyChan      chan struct{}
+	progress        RangeProgress
+	progressMutex   sync.Mutex
+	filterStats     filterStatsCollector
+	errorHandler    func(error)
+	rateLimiterID   uint64
 }
 
-func NewCompactor(sstableManager *sstable.SSTableManager, minThreshold int, gcBefore int64) *Compactor {
-	return &Compactor{
-		sstableManager: sstableManager,
-		minThreshold:   minThreshold,
-		gcBefore:       gcBefore,
-		stopChan:       make(chan struct{}),
+func NewCompactor(sstableManager *sstable.SSTableManager, opts Options) *Compactor {
+	opts = opts.withDefaults()
+	c := &Compactor{
+		sstableManager:  sstableManager,
+		opts:            opts,
+		compactPointers: make([]string, opts.NumLevels),
+		stopChan:        make(chan struct{}),
+		doneChan:        make(chan struct{}),
+		notifyChan:      make(chan struct{}, 1),
 	}
+	if limiter := sstableManager.RateLimiter(); limiter != nil {
+		c.rateLimiterID = limiter.NewID()
+	}
+	return c
 }
 
 func (c *Compactor) Start() {
 	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
+		defer close(c.doneChan)
+		ticker := time.NewTicker(c.opts.Interval)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
-				c.performCompaction()
+				c.compactInBackground()
+			case <-c.notifyChan:
+				c.compactInBackground()
 			case <-c.stopChan:
 				return
 			}
@@ -42,64 +62,36 @@ func (c *Compactor) Start() {
 	}()
 }
 
-func (c *Compactor) Stop() {
-	close(c.stopChan)
+// SetErrorHandler registers a function called with the error of every failed
+// background compaction. Compactions postponed for lack of disk space have not
+// failed and are not reported. It must be called before Start.
+func (c *Compactor) SetErrorHandler(handler func(error)) {
+	c.errorHandler = handler
 }
 
-func (c *Compactor) groupSSTablesBySize() [][]*sstable.SSTable {
-	sstables := c.sstableManager.GetSSTables()
-	sort.Slice(sstables, func(i, j int) bool {
-		return sstables[i].Size() < sstables[j].Size()
-	})
-
-	var groups [][]*sstable.SSTable
-	var currentGroup []*sstable.SSTable
-
-	for _, sstable := range sstables {
-		if len(currentGroup) == 0 {
-			currentGroup = append(currentGroup, sstable)
-		} else {
-			if sstable.Size() == currentGroup[0].Size() {
-				currentGroup = append(currentGroup, sstable)
-			} else {
-				groups = append(groups, currentGroup)
-			}
-		}
-	}
-
-	if len(currentGroup) > 0 {
-		groups = append(groups, currentGroup)
+func (c *Compactor) compactInBackground() {
+	if err := c.performCompaction(); err != nil && c.errorHandler != nil {
+		c.errorHandler(err)
 	}
-
-	return groups
 }
 
-func (c *Compactor) filterBuckets(groups [][]*sstable.SSTable) [][]*sstable.SSTable {
-	var filteredGroups [][]*sstable.SSTable
-	for _, group := range groups {
-		if len(group) >= c.minThreshold {
-			filteredGroups = append(filteredGroups, group)
-		}
+// Stop ends background compaction, waiting for a running compaction to
+// finish. The store's debt no longer counts towards a shared rate limiter.
+func (c *Compactor) Stop() {
+	close(c.stopChan)
+	<-c.doneChan
+	if limiter := c.sstableManager.RateLimiter(); limiter != nil {
+		limiter.SetPendingCompactionBytes(c.rateLimiterID, 0)
 	}
-	return filteredGroups
 }
 
-func (c *Compactor) selectHighestReadHotnessScore(groups [][]*sstable.SSTable) []*sstable.SSTable {
-	var highestScoreGroup []*sstable.SSTable
-	var highestScore int64
-
-	for _, group := range groups {
-		var score int64
-		for _, sstable := range group {
-			score += sstable.ReadHotnessScore()
-		}
-		if score > highestScore {
-			highestScore = score
-			highestScoreGroup = group
-		}
+// Notify tells the compactor that the shape of the tree changed, for example
+// after a flush added a level 0 table. It never blocks.
+func (c *Compactor) Notify() {
+	select {
+	case c.notifyChan <- struct{}{}:
+	default:
 	}
-
-	return highestScoreGroup
 }
 
 func (c *Compactor) checkAvailableDiskSpace(inputSSTables []*sstable.SSTable) []*sstable.SSTable {
@@ -126,27 +118,151 @@ func (c *Compactor) checkAvailableDiskSpace(inputSSTables []*sstable.SSTable) []
 	return inputSSTables
 }
 
+// getAvailableDiskSpace returns the free space in the data directory minus
+// ReservedDiskSpace. If the filesystem cannot be queried no limit is applied.
 func (c *Compactor) getAvailableDiskSpace() int64 {
-	// Implement this method to get the available disk space
-	// For example, you can use the syscall package to get the disk usage
-	return 1024 * 1024 * 1024 // Example: 1 GB available disk space
+	free, err := diskspace.Free(c.sstableManager.Dir(), c.opts.ReservedDiskSpace)
+	if err != nil {
+		return math.MaxInt64
+	}
+	return free
 }
 
+// hasSpaceFor reports whether the job's output, which is at most as large as
+// its inputs, fits in the available disk space.
+func (c *Compactor) hasSpaceFor(j *job) bool {
+	return j.deleteOnly || j.trivialMove || totalSize(j.inputs) <= c.getAvailableDiskSpace()
+}
+
+// performCompaction runs compactions picked by the configured style until
+// there is nothing left to do. A compaction whose output would not fit on
+// disk is postponed until the next run, which the tree triggers once space
+// has been freed.
 func (c *Compactor) performCompaction() error {
-	groups := c.groupSSTablesBySize()
-	filteredGroups := c.filterBuckets(groups)
-	selectedGroup := c.selectHighestReadHotnessScore(filteredGroups)
-	inputSSTables := c.checkAvailableDiskSpace(selectedGroup)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	outputFileName := "output.sst"
-	return c.mergeSSTables(inputSSTables, outputFileName)
+	for {
+		c.updateRateLimiter()
+		j := c.pickCompaction()
+		if j == nil {
+			return nil
+		}
+		if !c.hasSpaceFor(j) {
+			return nil
+		}
+		if _, err := c.runJob(j); err != nil {
+			return err
+		}
+	}
 }
 
-func (c *Compactor) mergeSSTables(inputSSTables []*sstable.SSTable, outputFileName string) error {
-	outputSSTable := sstable.NewSSTable(outputFileName)
-	scanners := make([]*sstable.Scanner, len(inputSSTables))
-	for i, sstable := range inputSSTables {
-		scanners[i] = sstable.NewScanner()
+func (c *Compactor) pickCompaction() *job {
+	switch c.opts.Style {
+	case StyleSizeTiered:
+		return c.pickSizeTieredCompaction()
+	case StyleUniversal:
+		return c.pickUniversalCompaction()
+	case StyleFIFO:
+		return c.pickFIFOCompaction()
+	default:
+		return c.pickLeveledCompaction()
+	}
+}
+
+func (c *Compactor) runJob(j *job) ([]*sstable.SSTable, error) {
+	if j.deleteOnly {
+		return nil, c.sstableManager.InstallCompaction(j.inputs, nil, j.outputLevel)
+	}
+	if j.trivialMove {
+		if err := c.sstableManager.MoveTables(j.inputs, j.outputLevel); err != nil {
+			return nil, err
+		}
+		c.advanceCompactPointer(j)
+		return nil, nil
+	}
+
+	outputs, err := c.mergeSSTables(j)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.sstableManager.InstallCompaction(j.inputs, outputs, j.outputLevel); err != nil {
+		return nil, err
+	}
+
+	c.advanceCompactPointer(j)
+	return outputs, nil
+}
+
+func (c *Compactor) advanceCompactPointer(j *job) {
+	if j.level > 0 && !j.manual {
+		_, end := keyRange(j.inputs[:1])
+		c.compactPointers[j.level] = end
+	}
+}
+
+// mergeSSTables merges the job's inputs into new tables for its output level.
+// Large jobs are split into subcompactions over disjoint key ranges that run
+// in parallel; their outputs are returned in key order.
+func (c *Compactor) mergeSSTables(j *job) ([]*sstable.SSTable, error) {
+	boundaries := c.subcompactionBoundaries(j)
+	if len(boundaries) == 0 {
+		return c.mergeRange(j, "", "")
+	}
+
+	starts := append([]string{""}, boundaries...)
+	ends := append(boundaries, "")
+	results := make([][]*sstable.SSTable, len(starts))
+	errs := make([]error, len(starts))
+
+	var wg sync.WaitGroup
+	for i := range starts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = c.mergeRange(j, starts[i], ends[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var outputs []*sstable.SSTable
+	for _, result := range results {
+		outputs = append(outputs, result...)
+	}
+	for _, err := range errs {
+		if err != nil {
+			for _, sst := range outputs {
+				sst.Remove()
+			}
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+// mergeRange merges the keys of the job's inputs in [start, end) into new
+// tables, cut at the target file size. Only the newest version of each key is
+// kept, it is passed through the compaction filter if one is configured, and
+// tombstones are dropped once no other table can hold an older version.
+func (c *Compactor) mergeRange(j *job, start, end string) ([]*sstable.SSTable, error) {
+	filter := c.newCompactionFilter(j)
+	var stats FilterStats
+	defer func() { c.filterStats.add(stats) }()
+
+	inputSSTables := j.inputs
+	scanners := make([]*sstable.Scanner, 0, len(inputSSTables))
+	defer func() {
+		for _, scanner := range scanners {
+			scanner.Close()
+		}
+	}()
+	for _, sstable := range inputSSTables {
+		scanner, err := sstable.NewRangeScanner(start, end)
+		if err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, scanner)
 	}
 
 	pq := &PriorityQueue{}
@@ -158,15 +274,121 @@ func (c *Compactor) mergeSSTables(inputSSTables []*sstable.SSTable, outputFileNa
 		}
 	}
 
+	var outputs []*sstable.SSTable
+	var writer *sstable.Writer
+	abort := func() {
+		if writer != nil {
+			writer.Abort()
+		}
+		for _, sst := range outputs {
+			sst.Remove()
+		}
+	}
+
+	var lastKey string
+	first := true
 	for pq.Len() > 0 {
 		scanner := heap.Pop(pq).(*sstable.Scanner)
-		key, value := scanner.Next()
-
-		outputSSTable.Write(map[string]string{key: value})
-
+		entry := scanner.Next()
 		if scanner.HasNext() {
 			heap.Push(pq, scanner)
 		}
+
+		// Versions of a key come out newest first; older ones are shadowed.
+		if !first && entry.Key == lastKey {
+			continue
+		}
+		first = false
+		lastKey = entry.Key
+
+		if filter != nil && !entry.Deleted {
+			decision, newValue := filter.Filter(j.outputLevel, entry.Key, entry.Value)
+			switch decision {
+			case FilterRemove:
+				entry.Deleted = true
+				entry.Value = ""
+				stats.Removed++
+			case FilterChangeValue:
+				entry.Value = newValue
+				stats.Changed++
+			default:
+				stats.Kept++
+			}
+		}
+
+		if entry.Deleted && isBottommost(j, entry.Key) {
+			continue
+		}
+
+		if writer == nil {
+			output := c.sstableManager.NewTable(j.outputLevel)
+			w, err := output.NewWriter()
+			if err != nil {
+				abort()
+				return nil, err
+			}
+			w.SetRateLimiter(c.sstableManager.RateLimiter(), ratelimit.PriorityLow)
+			w.SetNewestEntryTime(newestEntryTime(j.inputs))
+			writer = w
+			outputs = append(outputs, output)
+		}
+		if err := writer.Add(entry); err != nil {
+			abort()
+			return nil, err
+		}
+		if !j.singleOutput && writer.EstimatedSize() >= c.opts.TargetFileSize {
+			if err := writer.Finish(); err != nil {
+				writer = nil
+				abort()
+				return nil, err
+			}
+			writer = nil
+		}
+	}
+
+	for _, scanner := range scanners {
+		if err := scanner.Err(); err != nil {
+			abort()
+			return nil, err
+		}
+	}
+
+	if writer != nil {
+		if err := writer.Finish(); err != nil {
+			writer = nil
+			abort()
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+// newestEntryTime returns the write time of the newest entry in tables, which
+// bounds that of every entry merged from them.
+func newestEntryTime(tables []*sstable.SSTable) time.Time {
+	var newest time.Time
+	for _, sst := range tables {
+		if t := sst.NewestEntryTime(); t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
+// isBottommost reports whether no table outside the job's inputs, in the
+// output level or below, can hold an older version of key.
+func isBottommost(j *job, key string) bool {
+	inputs := make(map[*sstable.SSTable]bool, len(j.inputs))
+	for _, sst := range j.inputs {
+		inputs[sst] = true
+	}
+
+	for _, tables := range j.levels[j.outputLevel:] {
+		for _, sst := range overlapping(tables, key, key) {
+			if !inputs[sst] {
+				return false
+			}
+		}
 	}
-	return nil
+	return true
 }
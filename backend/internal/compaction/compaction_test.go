@@ -0,0 +1,140 @@
+package compaction
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/diskspace"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// testStore is a table manager fed with flushed tables by the test, standing
+// in for the tree above the compactor.
+type testStore struct {
+	t   *testing.T
+	m   *sstable.SSTableManager
+	seq uint64
+	// writeTime is the time of the newest write recorded for flushed
+	// tables; zero means the time of the flush.
+	writeTime time.Time
+}
+
+func newTestStore(t *testing.T) *testStore {
+	t.Helper()
+	m := sstable.NewSSTableManager(t.TempDir(), sstable.Options{FilterPolicy: sstable.NewBloomFilterPolicy(0.01)})
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return &testStore{t: t, m: m}
+}
+
+func testKey(i int) string {
+	return fmt.Sprintf("key%06d", i)
+}
+
+// flush writes a level 0 table setting the keys [from, to) to value.
+func (s *testStore) flush(from, to int, value string) {
+	s.t.Helper()
+	var entries []sstable.Entry
+	for i := from; i < to; i++ {
+		s.seq++
+		entries = append(entries, sstable.Entry{Key: testKey(i), Value: value, Seq: s.seq})
+	}
+	s.flushEntries(entries)
+}
+
+// flushEntries writes a level 0 table holding entries, which must be sorted.
+// Entries without a sequence number get the next one.
+func (s *testStore) flushEntries(entries []sstable.Entry) {
+	s.t.Helper()
+	for i := range entries {
+		if entries[i].Seq == 0 {
+			s.seq++
+			entries[i].Seq = s.seq
+		}
+		s.seq = max(s.seq, entries[i].Seq)
+	}
+	writeTime := s.writeTime
+	if writeTime.IsZero() {
+		writeTime = time.Now()
+	}
+	if err := s.m.CreateSSTable(entries, s.seq, writeTime); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *testStore) get(key string) (string, bool) {
+	s.t.Helper()
+	value, found, err := s.m.Read(key, math.MaxUint64)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return value, found
+}
+
+// checkRange checks that the keys [from, to) hold value.
+func (s *testStore) checkRange(from, to int, value string) {
+	s.t.Helper()
+	for i := from; i < to; i++ {
+		if got, found := s.get(testKey(i)); !found || got != value {
+			s.t.Fatalf("%s: got %q, %v, want %q", testKey(i), got, found, value)
+		}
+	}
+}
+
+// tableCounts returns the number of tables in each level.
+func (s *testStore) tableCounts() []int {
+	var counts []int
+	for _, tables := range s.m.Levels() {
+		counts = append(counts, len(tables))
+	}
+	return counts
+}
+
+func (s *testStore) compact(c *Compactor) {
+	s.t.Helper()
+	if err := c.performCompaction(); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func TestCompactionPostponedForDiskSpace(t *testing.T) {
+	s := newTestStore(t)
+	// Overlapping tables, which cannot simply be moved down.
+	for i := 0; i < 4; i++ {
+		s.flush(0, 400, fmt.Sprint(i))
+	}
+	free, err := diskspace.Free(s.m.Dir(), 0)
+	if err != nil || free == math.MaxInt64 {
+		t.Skip("free disk space is unknown")
+	}
+
+	var reported []error
+	c := NewCompactor(s.m, Options{
+		Level0FileNumCompactionTrigger: 4,
+		// Leave room for far less than the inputs.
+		ReservedDiskSpace: free - 1024,
+	})
+	c.SetErrorHandler(func(err error) { reported = append(reported, err) })
+
+	c.compactInBackground()
+	if len(reported) > 0 {
+		t.Fatalf("postponed compaction reported %v", reported)
+	}
+	if counts := s.tableCounts(); counts[0] != 4 {
+		t.Fatalf("compaction ran without disk space, tables per level %v", counts)
+	}
+
+	c.opts.ReservedDiskSpace = 0
+	c.compactInBackground()
+	if len(reported) > 0 {
+		t.Fatalf("compaction reported %v", reported)
+	}
+	if counts := s.tableCounts(); counts[0] != 0 {
+		t.Fatalf("compaction did not run once space was available, tables per level %v", counts)
+	}
+	s.checkRange(0, 400, "3")
+}
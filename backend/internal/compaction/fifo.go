@@ -0,0 +1,43 @@
+package compaction
+
+import (
+	"time"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// FIFO compaction never rewrites data. Tables stay in level 0 and the oldest
+// ones are deleted once their newest entry has outlived TTL or once the total
+// size of all tables exceeds FIFOMaxTableFilesSize. It suits time-series data
+// such as logs and metrics that is only useful for a limited time.
+
+// pickFIFOCompaction returns a job deleting the tables that have aged out,
+// or nil if every table is still within limits.
+func (c *Compactor) pickFIFOCompaction() *job {
+	levels := c.snapshotLevels()
+	tables := levels[0] // oldest first
+
+	var expired []*sstable.SSTable
+	remaining := totalSize(tables)
+	now := time.Now()
+	for _, sst := range tables {
+		tooOld := c.opts.TTL > 0 && now.Sub(sst.NewestEntryTime()) > c.opts.TTL
+		tooLarge := c.opts.FIFOMaxTableFilesSize > 0 && remaining > c.opts.FIFOMaxTableFilesSize
+		if !tooOld && !tooLarge {
+			break
+		}
+		expired = append(expired, sst)
+		remaining -= sst.Size()
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	return &job{
+		level:       0,
+		outputLevel: 0,
+		inputs:      expired,
+		levels:      levels,
+		deleteOnly:  true,
+	}
+}
@@ -0,0 +1,87 @@
+package compaction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFIFOCompaction(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		// writeAges is how long ago the newest write of each table, oldest
+		// table first, happened.
+		writeAges []time.Duration
+		want      int // tables left
+	}{
+		{"within limits", Options{TTL: time.Hour}, []time.Duration{30 * time.Minute, 0}, 2},
+		{"expired", Options{TTL: time.Hour}, []time.Duration{3 * time.Hour, 2 * time.Hour, 0}, 1},
+		{"no TTL", Options{}, []time.Duration{3 * time.Hour, 0}, 2},
+		// Only a prefix of the oldest tables is deleted.
+		{"expired after a live table", Options{TTL: time.Hour}, []time.Duration{0, 3 * time.Hour}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestStore(t)
+			for i, age := range test.writeAges {
+				// Tables are flushed now, whatever the age of their data.
+				s.writeTime = time.Now().Add(-age)
+				s.flush(i*10, (i+1)*10, "v")
+			}
+			test.opts.Style = StyleFIFO
+			if test.opts.FIFOMaxTableFilesSize == 0 {
+				test.opts.FIFOMaxTableFilesSize = 1 << 30
+			}
+			s.compact(NewCompactor(s.m, test.opts))
+
+			counts := s.tableCounts()
+			if counts[0] != test.want {
+				t.Fatalf("%d tables left, want %d", counts[0], test.want)
+			}
+			// The newest table always survives.
+			last := len(test.writeAges) - 1
+			s.checkRange(last*10, (last+1)*10, "v")
+		})
+	}
+}
+
+func TestFIFOCompactionSizeCap(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 5; i++ {
+		s.flush(i*10, (i+1)*10, "v")
+	}
+	tables := s.m.Levels()[0]
+	// Room for the two newest tables and a bit.
+	limit := tables[3].Size() + tables[4].Size() + 1
+
+	s.compact(NewCompactor(s.m, Options{Style: StyleFIFO, FIFOMaxTableFilesSize: limit}))
+	if left := s.m.Levels()[0]; len(left) != 2 || left[0] != tables[3] || left[1] != tables[4] {
+		t.Fatalf("%d tables left, want the two newest", len(left))
+	}
+	s.checkRange(30, 50, "v")
+	if _, found := s.get(testKey(0)); found {
+		t.Fatal("found a key of a deleted table")
+	}
+}
+
+func TestCompactionKeepsNewestEntryTime(t *testing.T) {
+	s := newTestStore(t)
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	s.writeTime = old
+	s.flush(0, 100, "a")
+	s.writeTime = old.Add(time.Hour)
+	s.flush(0, 100, "b")
+
+	c := NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 2})
+	s.compact(c)
+	tables := s.m.Levels()[1]
+	if len(tables) != 1 {
+		t.Fatalf("%d tables in level 1, want 1", len(tables))
+	}
+	if got := tables[0].NewestEntryTime(); !got.Equal(old.Add(time.Hour)) {
+		t.Fatalf("compaction output newest entry time %v, want %v", got, old.Add(time.Hour))
+	}
+	if created := tables[0].CreatedAt(); time.Since(created) > time.Minute {
+		t.Fatalf("compaction output created at %v", created)
+	}
+}
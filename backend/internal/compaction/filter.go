@@ -0,0 +1,90 @@
+package compaction
+
+import "sync"
+
+// FilterDecision tells compaction what to do with a record passed to a
+// CompactionFilter.
+type FilterDecision int
+
+const (
+	// FilterKeep writes the record unchanged.
+	FilterKeep FilterDecision = iota
+	// FilterRemove drops the record. It is replaced by a tombstone so older
+	// versions in deeper levels stay hidden until they are compacted away.
+	FilterRemove
+	// FilterChangeValue writes the record with the value returned alongside
+	// the decision.
+	FilterChangeValue
+)
+
+// CompactionFilter is called for the newest live version of every key that
+// compaction rewrites, which makes it a place for user-defined garbage
+// collection such as dropping expired tenants or migrating values.
+type CompactionFilter interface {
+	Name() string
+	Filter(level int, key, value string) (FilterDecision, string)
+}
+
+// CompactionFilterContext describes the compaction a filter is created for.
+type CompactionFilterContext struct {
+	OutputLevel        int
+	IsFullCompaction   bool
+	IsManualCompaction bool
+}
+
+// CompactionFilterFactory creates a filter per compaction job, so filters can
+// keep per-job state without synchronisation.
+type CompactionFilterFactory interface {
+	Name() string
+	CreateCompactionFilter(ctx CompactionFilterContext) CompactionFilter
+}
+
+// FilterStats counts the records seen by compaction filters.
+type FilterStats struct {
+	Kept    int64 `json:"kept"`
+	Removed int64 `json:"removed"`
+	Changed int64 `json:"changed"`
+}
+
+type filterStatsCollector struct {
+	stats FilterStats
+	mutex sync.Mutex
+}
+
+func (f *filterStatsCollector) add(stats FilterStats) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.stats.Kept += stats.Kept
+	f.stats.Removed += stats.Removed
+	f.stats.Changed += stats.Changed
+}
+
+func (f *filterStatsCollector) get() FilterStats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.stats
+}
+
+// FilterStats returns the totals of every compaction since the compactor was
+// created.
+func (c *Compactor) FilterStats() FilterStats {
+	return c.filterStats.get()
+}
+
+// newCompactionFilter returns the filter for a job: a fresh one from the
+// factory if there is one, otherwise the shared filter, which may be nil.
+func (c *Compactor) newCompactionFilter(j *job) CompactionFilter {
+	if c.opts.CompactionFilterFactory == nil {
+		return c.opts.CompactionFilter
+	}
+
+	total := 0
+	for _, tables := range j.levels {
+		total += len(tables)
+	}
+	return c.opts.CompactionFilterFactory.CreateCompactionFilter(CompactionFilterContext{
+		OutputLevel:        j.outputLevel,
+		IsFullCompaction:   len(j.inputs) == total,
+		IsManualCompaction: j.manual,
+	})
+}
@@ -0,0 +1,127 @@
+package compaction
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// everyThirdFilter removes every third key and upper-cases the value of the
+// key after it.
+type everyThirdFilter struct{}
+
+func (everyThirdFilter) Name() string { return "every-third" }
+
+func (everyThirdFilter) Filter(level int, key, value string) (FilterDecision, string) {
+	var i int
+	fmt.Sscanf(key, "key%d", &i)
+	switch i % 3 {
+	case 0:
+		return FilterRemove, ""
+	case 1:
+		return FilterChangeValue, strings.ToUpper(value)
+	}
+	return FilterKeep, ""
+}
+
+// checkFiltered checks that keys [from, to) were passed through
+// everyThirdFilter with value.
+func (s *testStore) checkFiltered(from, to int, value string) {
+	s.t.Helper()
+	for i := from; i < to; i++ {
+		got, found := s.get(testKey(i))
+		switch i % 3 {
+		case 0:
+			if found {
+				s.t.Fatalf("%s: removed by the filter, got %q", testKey(i), got)
+			}
+		case 1:
+			if !found || got != strings.ToUpper(value) {
+				s.t.Fatalf("%s: got %q, %v, want the changed value", testKey(i), got, found)
+			}
+		default:
+			if !found || got != value {
+				s.t.Fatalf("%s: got %q, %v, want %q", testKey(i), got, found, value)
+			}
+		}
+	}
+}
+
+func TestCompactionFilter(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 4; i++ {
+		s.flush(0, 300, fmt.Sprintf("v%d", i))
+	}
+	c := NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 4, CompactionFilter: everyThirdFilter{}})
+	s.compact(c)
+
+	s.checkFiltered(0, 300, "v3")
+	// Only the newest version of every key is passed to the filter.
+	if stats := c.FilterStats(); stats != (FilterStats{Kept: 100, Removed: 100, Changed: 100}) {
+		t.Fatalf("filter stats %+v", stats)
+	}
+}
+
+func TestCompactionFilterRemovalHidesOlderVersions(t *testing.T) {
+	s := newTestStore(t)
+	s.flush(0, 300, "old")
+	c := NewCompactor(s.m, Options{NumLevels: 3})
+	if err := c.CompactRange("", "", 1); err != nil {
+		t.Fatal(err)
+	}
+	c.opts.MaxBytesForLevelBase = 1
+	s.compact(c)
+	if counts := s.tableCounts(); counts[2] == 0 {
+		t.Fatalf("tables per level %v, want the old data in level 2", counts)
+	}
+
+	// Level 0 is compacted into level 1 only, above the old versions.
+	for i := 0; i < 4; i++ {
+		s.flush(0, 300, "new")
+	}
+	c.opts.MaxBytesForLevelBase = 1 << 30
+	c.opts.Level0FileNumCompactionTrigger = 4
+	c.opts.CompactionFilter = everyThirdFilter{}
+	s.compact(c)
+	if counts := s.tableCounts(); counts[0] != 0 || counts[1] == 0 || counts[2] == 0 {
+		t.Fatalf("tables per level %v, want data in levels 1 and 2", counts)
+	}
+	s.checkFiltered(0, 300, "new")
+}
+
+// recordingFactory creates everyThirdFilter and records the context of every
+// filter it creates.
+type recordingFactory struct {
+	contexts []CompactionFilterContext
+	mutex    sync.Mutex
+}
+
+func (f *recordingFactory) Name() string { return "recording" }
+
+func (f *recordingFactory) CreateCompactionFilter(ctx CompactionFilterContext) CompactionFilter {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.contexts = append(f.contexts, ctx)
+	return everyThirdFilter{}
+}
+
+func TestManualCompactionAppliesFilterFactory(t *testing.T) {
+	s := newTestStore(t)
+	// A single table with nothing below it would otherwise simply be moved.
+	s.flush(0, 300, "v")
+	factory := &recordingFactory{}
+	c := NewCompactor(s.m, Options{CompactionFilterFactory: factory})
+	if err := c.CompactRange("", "", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	s.checkFiltered(0, 300, "v")
+	if len(factory.contexts) != 1 {
+		t.Fatalf("%d filters created, want 1", len(factory.contexts))
+	}
+	want := CompactionFilterContext{OutputLevel: 1, IsFullCompaction: true, IsManualCompaction: true}
+	if got := factory.contexts[0]; got != want {
+		t.Fatalf("filter context %+v, want %+v", got, want)
+	}
+}
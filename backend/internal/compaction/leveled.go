@@ -0,0 +1,172 @@
+package compaction
+
+import (
+	"sort"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// job describes one compaction: the input tables taken from level and the
+// overlapping tables of outputLevel, merged into new tables in outputLevel.
+// Tiered strategies set singleOutput to merge everything into one table, and
+// FIFO sets deleteOnly to drop the inputs without writing anything. Inputs
+// that overlap nothing in the output level are moved there as they are when
+// trivialMove is set. Manual jobs come from CompactRange rather than the
+// configured style.
+type job struct {
+	level        int
+	outputLevel  int
+	inputs       []*sstable.SSTable
+	levels       [][]*sstable.SSTable
+	singleOutput bool
+	deleteOnly   bool
+	trivialMove  bool
+	manual       bool
+}
+
+func (c *Compactor) levelTargetSize(level int) int64 {
+	target := float64(c.opts.MaxBytesForLevelBase)
+	for i := 1; i < level; i++ {
+		target *= c.opts.LevelSizeMultiplier
+	}
+	return int64(target)
+}
+
+// levelScore is how far a level is over its target: the number of level 0
+// tables relative to the trigger, or the size of deeper levels relative to
+// their target size. Levels scoring 1 or more need compaction.
+func (c *Compactor) levelScore(levels [][]*sstable.SSTable, level int) float64 {
+	if level == 0 {
+		return float64(len(levels[0])) / float64(c.opts.Level0FileNumCompactionTrigger)
+	}
+	return float64(totalSize(levels[level])) / float64(c.levelTargetSize(level))
+}
+
+// pickLeveledCompaction chooses the level with the highest score and the
+// tables to compact from it. It returns nil if no level needs compaction.
+func (c *Compactor) pickLeveledCompaction() *job {
+	levels := c.snapshotLevels()
+
+	bestLevel, bestScore := -1, 1.0
+	for level := 0; level < c.opts.NumLevels-1; level++ {
+		if score := c.levelScore(levels, level); score >= bestScore {
+			bestLevel, bestScore = level, score
+		}
+	}
+	if bestLevel < 0 {
+		return nil
+	}
+
+	var inputs []*sstable.SSTable
+	if bestLevel == 0 {
+		inputs = append(inputs, levels[0]...)
+	} else {
+		inputs = append(inputs, c.pickFile(levels, bestLevel))
+	}
+
+	return c.expandToOutputLevel(levels, bestLevel, inputs)
+}
+
+// pickFile takes the table whose overlap with the next level is smallest
+// relative to its own size, as it costs the least to push down. Ties go to the
+// first table after the key where the last compaction of this level stopped,
+// so that compactions cycle through the key space.
+func (c *Compactor) pickFile(levels [][]*sstable.SSTable, level int) *sstable.SSTable {
+	tables := levels[level]
+	pointer := c.compactPointers[level]
+
+	start := 0
+	for start < len(tables) && tables[start].Smallest() <= pointer {
+		start++
+	}
+
+	var best *sstable.SSTable
+	bestRatio := 0.0
+	for i := range tables {
+		sst := tables[(start+i)%len(tables)]
+		ratio := overlapRatio(sst, levels[level+1])
+		if best == nil || ratio < bestRatio {
+			best, bestRatio = sst, ratio
+		}
+	}
+	return best
+}
+
+// overlapRatio is the size of the tables in next overlapping sst divided by
+// the size of sst.
+func overlapRatio(sst *sstable.SSTable, next []*sstable.SSTable) float64 {
+	overlap := totalSize(overlapping(next, sst.Smallest(), sst.Largest()))
+	return float64(overlap) / float64(sst.Size()+1)
+}
+
+// expandToOutputLevel adds every table of the next level that overlaps the
+// key range of inputs, so the output level stays free of overlaps. If there
+// are none and the inputs do not overlap each other, the job is a trivial
+// move.
+func (c *Compactor) expandToOutputLevel(levels [][]*sstable.SSTable, level int, inputs []*sstable.SSTable) *job {
+	start, end := keyRange(inputs)
+	outputLevel := level + 1
+	overlaps := overlapping(levels[outputLevel], start, end)
+
+	return &job{
+		level:       level,
+		outputLevel: outputLevel,
+		inputs:      append(inputs, overlaps...),
+		levels:      levels,
+		trivialMove: len(overlaps) == 0 && disjoint(inputs),
+	}
+}
+
+// snapshotLevels returns the manager's levels padded to NumLevels.
+func (c *Compactor) snapshotLevels() [][]*sstable.SSTable {
+	levels := c.sstableManager.Levels()
+	for len(levels) < c.opts.NumLevels {
+		levels = append(levels, nil)
+	}
+	return levels
+}
+
+func keyRange(tables []*sstable.SSTable) (string, string) {
+	start, end := tables[0].Smallest(), tables[0].Largest()
+	for _, sst := range tables[1:] {
+		if sst.Smallest() < start {
+			start = sst.Smallest()
+		}
+		if sst.Largest() > end {
+			end = sst.Largest()
+		}
+	}
+	return start, end
+}
+
+// disjoint reports whether no two tables share any part of their key ranges.
+func disjoint(tables []*sstable.SSTable) bool {
+	sorted := make([]*sstable.SSTable, len(tables))
+	copy(sorted, tables)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Smallest() < sorted[j].Smallest() })
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Smallest() <= sorted[i-1].Largest() {
+			return false
+		}
+	}
+	return true
+}
+
+func overlapping(tables []*sstable.SSTable, start, end string) []*sstable.SSTable {
+	var result []*sstable.SSTable
+	for _, sst := range tables {
+		if sst.Overlaps(start, end) {
+			result = append(result, sst)
+		}
+	}
+	return result
+}
+
+func totalSize(tables []*sstable.SSTable) int64 {
+	var size int64
+	for _, sst := range tables {
+		size += sst.Size()
+	}
+	return size
+}
@@ -0,0 +1,166 @@
+package compaction
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// checkLevelsDisjoint checks that the tables of every level below level 0 are
+// sorted by key and do not overlap.
+func (s *testStore) checkLevelsDisjoint() {
+	s.t.Helper()
+	for level, tables := range s.m.Levels() {
+		for i := 1; level > 0 && i < len(tables); i++ {
+			if tables[i-1].Largest() >= tables[i].Smallest() {
+				s.t.Fatalf("level %d: tables %d and %d overlap", level, i-1, i)
+			}
+		}
+	}
+}
+
+func TestLeveledCompaction(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 3; i++ {
+		s.flush(0, 400, fmt.Sprint(i))
+	}
+	var deletes []sstable.Entry
+	for i := 0; i < 400; i += 4 {
+		deletes = append(deletes, sstable.Entry{Key: testKey(i), Deleted: true})
+	}
+	s.flushEntries(deletes)
+
+	c := NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 4, TargetFileSize: 1024})
+	s.compact(c)
+
+	counts := s.tableCounts()
+	if counts[0] != 0 || counts[1] < 2 {
+		t.Fatalf("tables per level %v, want level 0 compacted into several level 1 tables", counts)
+	}
+	s.checkLevelsDisjoint()
+	for i := 0; i < 400; i++ {
+		value, found := s.get(testKey(i))
+		if deleted := i%4 == 0; found == deleted || (!deleted && value != "2") {
+			t.Fatalf("%s: got %q, %v", testKey(i), value, found)
+		}
+	}
+	// Nothing below can hold an older version, so tombstones are dropped.
+	for _, info := range s.m.TableProperties() {
+		if info.Properties.NumDeletions > 0 {
+			t.Fatalf("table %d kept %d tombstones", info.Number, info.Properties.NumDeletions)
+		}
+	}
+}
+
+func TestLeveledCompactionBelowTrigger(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 3; i++ {
+		s.flush(0, 100, fmt.Sprint(i))
+	}
+	s.compact(NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 4}))
+	if counts := s.tableCounts(); counts[0] != 3 {
+		t.Fatalf("tables per level %v, want level 0 left alone", counts)
+	}
+}
+
+func TestLeveledCompactionPushesLevelsOverTarget(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 4; i++ {
+		s.flush(0, 400, fmt.Sprint(i))
+	}
+	opts := Options{NumLevels: 3, Level0FileNumCompactionTrigger: 4, TargetFileSize: 1024}
+	c := NewCompactor(s.m, opts)
+	s.compact(c)
+	if counts := s.tableCounts(); counts[1] == 0 || len(counts) > 2 && counts[2] != 0 {
+		t.Fatalf("tables per level %v, want everything in level 1", counts)
+	}
+
+	// Level 1 is now over its target and is pushed to the bottom level.
+	c.opts.MaxBytesForLevelBase = 1
+	s.compact(c)
+	counts := s.tableCounts()
+	if counts[0] != 0 || counts[1] != 0 || counts[2] == 0 {
+		t.Fatalf("tables per level %v, want everything in level 2", counts)
+	}
+	s.checkLevelsDisjoint()
+	s.checkRange(0, 400, "3")
+}
+
+func TestLevelTargetSizes(t *testing.T) {
+	c := NewCompactor(newTestStore(t).m, Options{MaxBytesForLevelBase: 1000, LevelSizeMultiplier: 10})
+	for level, want := range map[int]int64{1: 1000, 2: 10000, 3: 100000} {
+		if got := c.levelTargetSize(level); got != want {
+			t.Fatalf("level %d target %d, want %d", level, got, want)
+		}
+	}
+}
+
+func tableNumbers(tables []*sstable.SSTable) map[int]bool {
+	numbers := make(map[int]bool)
+	for _, sst := range tables {
+		numbers[sst.Number()] = true
+	}
+	return numbers
+}
+
+func TestTrivialMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		overlap  int // keys shared by neighbouring tables
+		wantMove bool
+	}{
+		{"disjoint tables", 0, true},
+		{"overlapping tables", 10, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestStore(t)
+			for i := 0; i < 4; i++ {
+				s.flush(i*100, (i+1)*100+test.overlap, fmt.Sprint(i))
+			}
+			flushed := tableNumbers(s.m.Levels()[0])
+
+			s.compact(NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 4}))
+			if counts := s.tableCounts(); counts[0] != 0 {
+				t.Fatalf("tables per level %v, want level 0 compacted", counts)
+			}
+			moved := tableNumbers(s.m.Levels()[1])
+			if same := fmt.Sprint(moved) == fmt.Sprint(flushed); same != test.wantMove {
+				t.Fatalf("level 1 tables %v, flushed %v, want moved %v", moved, flushed, test.wantMove)
+			}
+			s.checkLevelsDisjoint()
+			for i := 0; i < 4; i++ {
+				s.checkRange(i*100, (i+1)*100, fmt.Sprint(i))
+			}
+		})
+	}
+}
+
+func TestPickFileWithLeastOverlap(t *testing.T) {
+	s := newTestStore(t)
+	s.flush(0, 100, "old")
+	s.flush(200, 300, "old")
+	if err := s.m.MoveTables(s.m.Levels()[0], 2); err != nil {
+		t.Fatal(err)
+	}
+	// Only the middle table overlaps nothing in level 2.
+	s.flush(0, 50, "new")
+	s.flush(120, 170, "new")
+	s.flush(200, 250, "new")
+	if err := s.m.MoveTables(s.m.Levels()[0], 1); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCompactor(s.m, Options{NumLevels: 3})
+	levels := c.snapshotLevels()
+	if got := c.pickFile(levels, 1); got != levels[1][1] {
+		t.Fatalf("picked the table starting at %s, want the one without overlap", got.Smallest())
+	}
+
+	c.opts.MaxBytesForLevelBase = 1
+	j := c.pickLeveledCompaction()
+	if j == nil || !j.trivialMove || len(j.inputs) != 1 || j.inputs[0] != levels[1][1] {
+		t.Fatal("the table without overlap is not moved down first")
+	}
+}
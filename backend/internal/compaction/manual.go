@@ -0,0 +1,259 @@
+package compaction
+
+import (
+	"sync"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/diskspace"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// RangeProgress reports the state of the current or last manual range
+// compaction.
+type RangeProgress struct {
+	Running      bool   `json:"running"`
+	Start        string `json:"start"`
+	End          string `json:"end"`
+	Level        int    `json:"level"`
+	JobsTotal    int    `json:"jobs_total"`
+	JobsDone     int    `json:"jobs_done"`
+	BytesRead    int64  `json:"bytes_read"`
+	BytesWritten int64  `json:"bytes_written"`
+	Error        string `json:"error,omitempty"`
+}
+
+// CompactRange compacts every table overlapping [start, end] down to the
+// bottom level. An empty start or end leaves that side of the range open.
+// With leveled compaction each level is compacted into the next in up to
+// maxJobs parallel jobs over disjoint key ranges. Size-tiered compaction
+// merges the overlapping tables into one, and universal compaction the span of
+// sorted runs from the newest to the oldest overlapping one. Background
+// compaction waits until it is done.
+func (c *Compactor) CompactRange(start, end string, maxJobs int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+	c.setProgress(func(p *RangeProgress) {
+		*p = RangeProgress{Running: true, Start: start, End: end}
+	})
+
+	err := c.compactRange(start, end, maxJobs)
+
+	c.setProgress(func(p *RangeProgress) {
+		p.Running = false
+		if err != nil {
+			p.Error = err.Error()
+		}
+	})
+	return err
+}
+
+func (c *Compactor) RangeProgress() RangeProgress {
+	c.progressMutex.Lock()
+	defer c.progressMutex.Unlock()
+	return c.progress
+}
+
+func (c *Compactor) setProgress(update func(p *RangeProgress)) {
+	c.progressMutex.Lock()
+	defer c.progressMutex.Unlock()
+	update(&c.progress)
+}
+
+func (c *Compactor) compactRange(start, end string, maxJobs int) error {
+	switch c.opts.Style {
+	case StyleFIFO:
+		// FIFO never rewrites data; the best it can do is expire tables.
+		if j := c.pickFIFOCompaction(); j != nil {
+			return c.runRangeJobs([]*job{j}, 1)
+		}
+		return nil
+	case StyleSizeTiered, StyleUniversal:
+		levels := c.snapshotLevels()
+		inputs := inRange(levels[0], start, end)
+		if c.opts.Style == StyleUniversal {
+			inputs = spanOfRuns(levels[0], inputs)
+		}
+		if len(inputs) < 2 {
+			return nil
+		}
+		j := &job{
+			inputs:       inputs,
+			levels:       levels,
+			singleOutput: true,
+			manual:       true,
+		}
+		return c.runRangeJobs([]*job{j}, 1)
+	}
+
+	bottom := c.bottomLevel()
+	for level := 0; level < bottom; level++ {
+		c.setProgress(func(p *RangeProgress) { p.Level = level })
+
+		jobs := c.rangeJobs(level, start, end)
+		if err := c.runRangeJobs(jobs, maxJobs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bottomLevel is the deepest level holding data, or level 1 if only level 0
+// does.
+func (c *Compactor) bottomLevel() int {
+	levels := c.snapshotLevels()
+	for level := len(levels) - 1; level > 1; level-- {
+		if len(levels[level]) > 0 {
+			return level
+		}
+	}
+	return 1
+}
+
+// rangeJobs splits the tables of level overlapping [start, end] into jobs
+// that can run in parallel. Level 0 tables may overlap each other and are
+// always compacted together; in deeper levels every table is its own job
+// unless neighbouring tables share a table in the next level.
+func (c *Compactor) rangeJobs(level int, start, end string) []*job {
+	levels := c.snapshotLevels()
+
+	if level == 0 {
+		if len(inRange(levels[0], start, end)) == 0 {
+			return nil
+		}
+		// Older level 0 tables can hold older versions of the same keys, so
+		// they are all compacted together.
+		j := c.expandToOutputLevel(levels, 0, levels[0])
+		c.markManual(j)
+		return []*job{j}
+	}
+
+	var jobs []*job
+	for _, sst := range inRange(levels[level], start, end) {
+		j := c.expandToOutputLevel(levels, level, []*sstable.SSTable{sst})
+		c.markManual(j)
+
+		if len(jobs) > 0 && sharesTable(jobs[len(jobs)-1], j) {
+			last := jobs[len(jobs)-1]
+			last.inputs = mergeInputs(last.inputs, j.inputs)
+			last.trivialMove = false
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// runRangeJobs runs jobs on up to maxJobs goroutines and returns the first
+// error. It fails with diskspace.ErrNoSpace up front if the outputs of all
+// jobs might not fit on disk.
+func (c *Compactor) runRangeJobs(jobs []*job, maxJobs int) error {
+	var needed int64
+	for _, j := range jobs {
+		if !j.deleteOnly && !j.trivialMove {
+			needed += totalSize(j.inputs)
+		}
+	}
+	if needed > c.getAvailableDiskSpace() {
+		return diskspace.ErrNoSpace
+	}
+
+	c.setProgress(func(p *RangeProgress) { p.JobsTotal += len(jobs) })
+
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, maxJobs)
+
+	for _, j := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(j *job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			outputs, err := c.runJob(j)
+			if err != nil {
+				errMutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMutex.Unlock()
+				return
+			}
+
+			c.setProgress(func(p *RangeProgress) {
+				p.JobsDone++
+				p.BytesRead += totalSize(j.inputs)
+				p.BytesWritten += totalSize(outputs)
+			})
+		}(j)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// markManual flags a job as manual. Manual compactions are how a compaction
+// filter is applied to existing data, so tables are not moved past the filter.
+func (c *Compactor) markManual(j *job) {
+	j.manual = true
+	if c.opts.CompactionFilter != nil || c.opts.CompactionFilterFactory != nil {
+		j.trivialMove = false
+	}
+}
+
+func inRange(tables []*sstable.SSTable, start, end string) []*sstable.SSTable {
+	var result []*sstable.SSTable
+	for _, sst := range tables {
+		if sst.Largest() >= start && (end == "" || sst.Smallest() <= end) {
+			result = append(result, sst)
+		}
+	}
+	return result
+}
+
+// spanOfRuns returns the runs from the oldest to the newest of selected, in
+// age order. Universal compaction only merges runs adjacent in age, so that
+// runs keep disjoint sequence ranges, even if this takes in runs outside the
+// key range.
+func spanOfRuns(runs, selected []*sstable.SSTable) []*sstable.SSTable {
+	if len(selected) == 0 {
+		return nil
+	}
+	first, last := -1, -1
+	for i, sst := range runs {
+		if sst == selected[0] {
+			first = i
+		}
+		if sst == selected[len(selected)-1] {
+			last = i
+		}
+	}
+	return runs[first : last+1]
+}
+
+func sharesTable(a, b *job) bool {
+	for _, x := range a.inputs {
+		for _, y := range b.inputs {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func mergeInputs(a, b []*sstable.SSTable) []*sstable.SSTable {
+	seen := make(map[*sstable.SSTable]bool, len(a))
+	for _, sst := range a {
+		seen[sst] = true
+	}
+	for _, sst := range b {
+		if !seen[sst] {
+			a = append(a, sst)
+		}
+	}
+	return a
+}
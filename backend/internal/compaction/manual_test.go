@@ -0,0 +1,81 @@
+package compaction
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompactRange(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 3; i++ {
+		s.flush(0, 400, fmt.Sprint(i))
+	}
+	c := NewCompactor(s.m, Options{TargetFileSize: 1024})
+	if err := c.CompactRange("", "", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if counts := s.tableCounts(); counts[0] != 0 || counts[1] == 0 {
+		t.Fatalf("tables per level %v, want everything in level 1", counts)
+	}
+	s.checkLevelsDisjoint()
+	s.checkRange(0, 400, "2")
+
+	progress := c.RangeProgress()
+	if progress.Running || progress.Error != "" || progress.JobsTotal == 0 || progress.JobsDone != progress.JobsTotal {
+		t.Fatalf("progress %+v", progress)
+	}
+	if progress.BytesRead == 0 || progress.BytesWritten == 0 {
+		t.Fatalf("progress %+v reports no I/O", progress)
+	}
+}
+
+func TestCompactRangeReachesBottomLevel(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 4; i++ {
+		s.flush(0, 400, fmt.Sprint(i))
+	}
+	c := NewCompactor(s.m, Options{NumLevels: 4, Level0FileNumCompactionTrigger: 4, TargetFileSize: 1024})
+	s.compact(c)
+	c.opts.MaxBytesForLevelBase = 1
+	s.compact(c)
+	c.opts.MaxBytesForLevelBase = 1 << 30
+
+	// Newer data in level 0 and 1 above the bottom level 3.
+	s.flush(100, 200, "new")
+	if err := c.CompactRange(testKey(0), testKey(99), 1); err != nil {
+		t.Fatal(err)
+	}
+	s.flush(150, 160, "newer")
+
+	if err := c.CompactRange(testKey(150), testKey(159), 4); err != nil {
+		t.Fatal(err)
+	}
+	levels := s.m.Levels()
+	for level := 0; level < len(levels)-1; level++ {
+		for _, sst := range levels[level] {
+			if sst.Overlaps(testKey(150), testKey(159)) {
+				t.Fatalf("level %d still holds table %d in the range", level, sst.Number())
+			}
+		}
+	}
+	s.checkLevelsDisjoint()
+	s.checkRange(0, 100, "3")
+	s.checkRange(100, 150, "new")
+	s.checkRange(150, 160, "newer")
+	s.checkRange(160, 200, "new")
+	s.checkRange(200, 400, "3")
+}
+
+func TestCompactRangeWithNothingInRange(t *testing.T) {
+	s := newTestStore(t)
+	s.flush(0, 100, "v")
+	s.flush(0, 100, "w")
+	c := NewCompactor(s.m, Options{})
+	if err := c.CompactRange(testKey(500), testKey(600), 1); err != nil {
+		t.Fatal(err)
+	}
+	if counts := s.tableCounts(); counts[0] != 2 {
+		t.Fatalf("tables per level %v, want level 0 untouched", counts)
+	}
+}
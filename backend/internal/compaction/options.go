@@ -0,0 +1,170 @@
+package compaction
+
+import "time"
+
+// Style selects the strategy the compactor uses to pick work.
+type Style int
+
+const (
+	// StyleLeveled keeps non-overlapping tables in levels of exponentially
+	// growing size.
+	StyleLeveled Style = iota
+	// StyleSizeTiered keeps all tables in level 0 and merges tables of
+	// similar size.
+	StyleSizeTiered
+	// StyleUniversal keeps all tables in level 0 as sorted runs ordered by
+	// age and merges adjacent runs, for write-heavy workloads.
+	StyleUniversal
+	// StyleFIFO keeps all tables in level 0 and deletes the oldest ones once
+	// they expire or the total size exceeds a cap, without rewriting data.
+	StyleFIFO
+)
+
+func (s Style) String() string {
+	switch s {
+	case StyleLeveled:
+		return "leveled"
+	case StyleSizeTiered:
+		return "size-tiered"
+	case StyleUniversal:
+		return "universal"
+	case StyleFIFO:
+		return "fifo"
+	}
+	return "unknown"
+}
+
+type Options struct {
+	Style Style
+
+	// NumLevels is the number of levels, including level 0.
+	NumLevels int
+
+	// Level0FileNumCompactionTrigger is the number of level 0 tables at which
+	// level 0 is compacted into level 1.
+	Level0FileNumCompactionTrigger int
+
+	// MaxBytesForLevelBase is the target size of level 1. Every deeper level
+	// targets LevelSizeMultiplier times the size of the level above it.
+	MaxBytesForLevelBase int64
+	LevelSizeMultiplier  float64
+
+	// TargetFileSize is the size at which compaction output is cut into a new
+	// table.
+	TargetFileSize int64
+
+	// MaxSubcompactions is the number of key ranges a large compaction is
+	// split into and run in parallel. One disables subcompactions.
+	MaxSubcompactions int
+
+	// MinThreshold and MaxThreshold bound the number of similarly sized
+	// tables merged together by size-tiered compaction.
+	MinThreshold int
+	MaxThreshold int
+
+	// BucketLow and BucketHigh are the size ratios to a bucket's average
+	// within which a table joins the bucket. Tables smaller than
+	// MinSSTableSize are always bucketed together.
+	BucketLow      float64
+	BucketHigh     float64
+	MinSSTableSize int64
+
+	// MaxSizeAmplificationPercent is how much larger, in percent, the newer
+	// sorted runs may grow relative to the oldest run before universal
+	// compaction merges all of them.
+	MaxSizeAmplificationPercent int
+
+	// SizeRatio is the percentage by which a sorted run may exceed the total
+	// size of the newer runs before it and still be merged with them.
+	// MinMergeWidth and MaxMergeWidth bound how many runs are merged at once;
+	// a MaxMergeWidth of zero means no limit.
+	SizeRatio     int
+	MinMergeWidth int
+	MaxMergeWidth int
+
+	// FIFOMaxTableFilesSize is the total size of all tables above which FIFO
+	// compaction deletes the oldest ones. TTL deletes tables whose newest
+	// entry is older than this. Zero disables either limit.
+	FIFOMaxTableFilesSize int64
+	TTL                   time.Duration
+
+	// CompactionFilter is shared by every compaction and must be safe for
+	// concurrent use. CompactionFilterFactory, if set, takes precedence and
+	// creates a filter per compaction job.
+	CompactionFilter        CompactionFilter
+	CompactionFilterFactory CompactionFilterFactory
+
+	// ReservedDiskSpace is the number of bytes kept free in the data
+	// directory. Compactions whose output would eat into it are narrowed or
+	// postponed, and the store rejects writes once free space falls below it.
+	// The default leaves room for a few tables of TargetFileSize.
+	ReservedDiskSpace int64
+
+	// Interval is how often the compactor checks for work on its own, in
+	// addition to being notified after flushes.
+	Interval time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		NumLevels:                      7,
+		Level0FileNumCompactionTrigger: 4,
+		MaxBytesForLevelBase:           10 * 1024 * 1024,
+		LevelSizeMultiplier:            10,
+		TargetFileSize:                 2 * 1024 * 1024,
+		MaxSubcompactions:              1,
+		MinThreshold:                   4,
+		MaxThreshold:                   32,
+		BucketLow:                      0.5,
+		BucketHigh:                     1.5,
+		MinSSTableSize:                 50 * 1024 * 1024,
+		MaxSizeAmplificationPercent:    200,
+		SizeRatio:                      1,
+		MinMergeWidth:                  2,
+		FIFOMaxTableFilesSize:          1024 * 1024 * 1024,
+		ReservedDiskSpace:              4 * 2 * 1024 * 1024,
+		Interval:                       5 * time.Minute,
+	}
+}
+
+// withDefaults fills in the fields that have no usable zero value from
+// DefaultOptions, so options built by hand keep the compactor working.
+// Fields whose zero value means something, such as a disabled limit, are
+// left alone.
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.NumLevels <= 0 {
+		o.NumLevels = defaults.NumLevels
+	}
+	if o.Level0FileNumCompactionTrigger <= 0 {
+		o.Level0FileNumCompactionTrigger = defaults.Level0FileNumCompactionTrigger
+	}
+	if o.MaxBytesForLevelBase <= 0 {
+		o.MaxBytesForLevelBase = defaults.MaxBytesForLevelBase
+	}
+	if o.LevelSizeMultiplier <= 0 {
+		o.LevelSizeMultiplier = defaults.LevelSizeMultiplier
+	}
+	if o.TargetFileSize <= 0 {
+		o.TargetFileSize = defaults.TargetFileSize
+	}
+	if o.MaxSubcompactions <= 0 {
+		o.MaxSubcompactions = defaults.MaxSubcompactions
+	}
+	if o.MinThreshold <= 0 {
+		o.MinThreshold = defaults.MinThreshold
+	}
+	if o.MaxThreshold <= 0 {
+		o.MaxThreshold = defaults.MaxThreshold
+	}
+	if o.BucketLow <= 0 && o.BucketHigh <= 0 {
+		o.BucketLow, o.BucketHigh = defaults.BucketLow, defaults.BucketHigh
+	}
+	if o.MinMergeWidth <= 0 {
+		o.MinMergeWidth = defaults.MinMergeWidth
+	}
+	if o.Interval <= 0 {
+		o.Interval = defaults.Interval
+	}
+	return o
+}
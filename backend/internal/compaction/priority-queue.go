@@ -6,8 +6,14 @@ type PriorityQueue []*sstable.Scanner
 
 func (pq PriorityQueue) Len() int { return len(pq) }
 
+// Less orders scanners by their next key and, for equal keys, puts the newest
+// version first.
 func (pq PriorityQueue) Less(i, j int) bool {
-	return pq[i].PeekKey() < pq[j].PeekKey()
+	a, b := pq[i].Peek(), pq[j].Peek()
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.Seq > b.Seq
 }
 
 func (pq PriorityQueue) Swap(i, j int) {
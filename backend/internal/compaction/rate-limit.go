@@ -0,0 +1,45 @@
+package compaction
+
+// updateRateLimiter reports the current compaction debt to an auto-tuned rate
+// limiter so compaction speeds up as it falls behind. A limiter shared between
+// stores adds up the debt of all of them.
+func (c *Compactor) updateRateLimiter() {
+	limiter := c.sstableManager.RateLimiter()
+	if limiter == nil {
+		return
+	}
+	limiter.SetPendingCompactionBytes(c.rateLimiterID, c.PendingCompactionBytes())
+}
+
+// PendingCompactionBytes estimates how many bytes compaction has to rewrite
+// to bring the tree back into shape. For leveled compaction this is level 0
+// once it reaches its trigger plus every deeper level's excess over its
+// target; tiered styles count everything but the largest run. FIFO never
+// rewrites data and has no debt.
+func (c *Compactor) PendingCompactionBytes() int64 {
+	levels := c.snapshotLevels()
+
+	switch c.opts.Style {
+	case StyleFIFO:
+		return 0
+	case StyleSizeTiered, StyleUniversal:
+		var largest int64
+		for _, sst := range levels[0] {
+			if sst.Size() > largest {
+				largest = sst.Size()
+			}
+		}
+		return totalSize(levels[0]) - largest
+	}
+
+	var debt int64
+	if c.levelScore(levels, 0) >= 1 {
+		debt += totalSize(levels[0])
+	}
+	for level := 1; level < c.opts.NumLevels-1; level++ {
+		if excess := totalSize(levels[level]) - c.levelTargetSize(level); excess > 0 {
+			debt += excess
+		}
+	}
+	return debt
+}
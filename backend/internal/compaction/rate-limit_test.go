@@ -0,0 +1,45 @@
+package compaction
+
+import (
+	"testing"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/ratelimit"
+)
+
+func TestSharedRateLimiterTunedByTotalDebt(t *testing.T) {
+	stores := []*testStore{newTestStore(t), newTestStore(t)}
+	var total int64
+	for _, s := range stores {
+		for i := 0; i < 4; i++ {
+			s.flush(0, 100, "v")
+		}
+		total += NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 4}).PendingCompactionBytes()
+	}
+	if total == 0 {
+		t.Fatal("no compaction debt")
+	}
+
+	// The ceiling sits at the total debt, so the limiter reaches its maximum
+	// only when the debt of both stores counts.
+	limiter := ratelimit.NewAutoTunedRateLimiter(0, 1000, total)
+	for _, s := range stores {
+		s.m.SetRateLimiter(limiter)
+	}
+	compactors := []*Compactor{
+		NewCompactor(stores[0].m, Options{Level0FileNumCompactionTrigger: 4}),
+		NewCompactor(stores[1].m, Options{Level0FileNumCompactionTrigger: 4}),
+	}
+	for _, c := range compactors {
+		c.updateRateLimiter()
+	}
+	if got := limiter.BytesPerSecond(); got != 1000 {
+		t.Fatalf("rate %d with both stores behind, want 1000", got)
+	}
+
+	// A stopped store no longer holds the rate up.
+	compactors[0].Start()
+	compactors[0].Stop()
+	if got := limiter.BytesPerSecond(); got <= 0 || got >= 1000 {
+		t.Fatalf("rate %d with one store stopped, want between 0 and 1000", got)
+	}
+}
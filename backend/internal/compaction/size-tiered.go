@@ -0,0 +1,113 @@
+package compaction
+
+import (
+	"sort"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// Size-tiered compaction keeps every table in level 0 and merges tables of
+// similar size, in the style of Cassandra's STCS. Tables are bucketed by size,
+// buckets with at least MinThreshold tables are candidates, and the bucket
+// with the highest read hotness is merged into a single table.
+
+// pickSizeTieredCompaction returns the hottest eligible bucket as a job, or
+// nil if no bucket has enough tables.
+func (c *Compactor) pickSizeTieredCompaction() *job {
+	levels := c.snapshotLevels()
+
+	groups := c.groupSSTablesBySize(levels[0])
+	filteredGroups := c.filterBuckets(groups)
+	selectedGroup := c.selectHighestReadHotnessScore(filteredGroups)
+	inputSSTables := c.checkAvailableDiskSpace(selectedGroup)
+	if len(inputSSTables) < 2 {
+		return nil
+	}
+
+	return &job{
+		level:        0,
+		outputLevel:  0,
+		inputs:       inputSSTables,
+		levels:       levels,
+		singleOutput: true,
+	}
+}
+
+// groupSSTablesBySize buckets tables whose size is within [BucketLow,
+// BucketHigh] times the bucket's average size. Tables smaller than
+// MinSSTableSize all share one bucket.
+func (c *Compactor) groupSSTablesBySize(sstables []*sstable.SSTable) [][]*sstable.SSTable {
+	sstables = append([]*sstable.SSTable(nil), sstables...)
+	sort.Slice(sstables, func(i, j int) bool {
+		return sstables[i].Size() < sstables[j].Size()
+	})
+
+	var groups [][]*sstable.SSTable
+	var averages []float64
+
+	for _, sst := range sstables {
+		size := float64(sst.Size())
+		placed := false
+		for i, average := range averages {
+			similar := size > average*c.opts.BucketLow && size < average*c.opts.BucketHigh
+			small := size < float64(c.opts.MinSSTableSize) && average < float64(c.opts.MinSSTableSize)
+			if similar || small {
+				total := average * float64(len(groups[i]))
+				groups[i] = append(groups[i], sst)
+				averages[i] = (total + size) / float64(len(groups[i]))
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			groups = append(groups, []*sstable.SSTable{sst})
+			averages = append(averages, size)
+		}
+	}
+
+	return groups
+}
+
+// filterBuckets drops buckets with fewer than MinThreshold tables and trims
+// the rest to their MaxThreshold hottest tables.
+func (c *Compactor) filterBuckets(groups [][]*sstable.SSTable) [][]*sstable.SSTable {
+	var filteredGroups [][]*sstable.SSTable
+	for _, group := range groups {
+		if len(group) < c.opts.MinThreshold {
+			continue
+		}
+		if c.opts.MaxThreshold > 0 && len(group) > c.opts.MaxThreshold {
+			group = append([]*sstable.SSTable(nil), group...)
+			sort.SliceStable(group, func(i, j int) bool {
+				return group[i].ReadHotnessScore() > group[j].ReadHotnessScore()
+			})
+			group = group[:c.opts.MaxThreshold]
+		}
+		filteredGroups = append(filteredGroups, group)
+	}
+	return filteredGroups
+}
+
+// selectHighestReadHotnessScore picks the bucket with the highest combined
+// hotness. Ties, including buckets that were never read, go to the bucket
+// with the smallest tables since it is the cheapest to merge.
+func (c *Compactor) selectHighestReadHotnessScore(groups [][]*sstable.SSTable) []*sstable.SSTable {
+	var highestScoreGroup []*sstable.SSTable
+	var highestScore int64
+	var highestAverage int64
+
+	for _, group := range groups {
+		var score int64
+		for _, sstable := range group {
+			score += sstable.ReadHotnessScore()
+		}
+		average := totalSize(group) / int64(len(group))
+		if highestScoreGroup == nil || score > highestScore || (score == highestScore && average < highestAverage) {
+			highestScore = score
+			highestAverage = average
+			highestScoreGroup = group
+		}
+	}
+
+	return highestScoreGroup
+}
@@ -0,0 +1,78 @@
+package compaction
+
+import (
+	"fmt"
+	"testing"
+)
+
+// flushSizeTiered flushes small and large tables in interleaved order, so
+// that the small ones are not adjacent in age.
+func flushSizeTiered(s *testStore) {
+	s.flush(0, 100, "small0")
+	s.flush(0, 2000, "large0")
+	s.flush(0, 100, "small1")
+	s.flush(0, 100, "small2")
+	s.flush(0, 2000, "large1")
+	s.flush(0, 100, "small3")
+}
+
+func TestSizeTieredBucketing(t *testing.T) {
+	s := newTestStore(t)
+	flushSizeTiered(s)
+	c := NewCompactor(s.m, Options{Style: StyleSizeTiered, MinSSTableSize: 1})
+
+	groups := c.groupSSTablesBySize(s.m.Levels()[0])
+	if len(groups) != 2 || len(groups[0]) != 4 || len(groups[1]) != 2 {
+		var sizes []int
+		for _, group := range groups {
+			sizes = append(sizes, len(group))
+		}
+		t.Fatalf("bucket sizes %v, want [4 2]", sizes)
+	}
+
+	// Below MinSSTableSize every table shares one bucket.
+	c.opts.MinSSTableSize = 1 << 30
+	if groups := c.groupSSTablesBySize(s.m.Levels()[0]); len(groups) != 1 {
+		t.Fatalf("%d buckets of small tables, want 1", len(groups))
+	}
+}
+
+func TestSizeTieredCompaction(t *testing.T) {
+	s := newTestStore(t)
+	flushSizeTiered(s)
+	c := NewCompactor(s.m, Options{Style: StyleSizeTiered, MinThreshold: 4, MinSSTableSize: 1})
+	s.compact(c)
+
+	// The small tables are merged into one; the pair of large ones stays
+	// below MinThreshold.
+	if counts := s.tableCounts(); len(counts) != 1 || counts[0] != 3 {
+		t.Fatalf("tables per level %v, want 3 tables in level 0", counts)
+	}
+	// The newest version wins even though the merged table spans the age of
+	// a large table.
+	s.checkRange(0, 100, "small3")
+	s.checkRange(100, 2000, "large1")
+}
+
+func TestSizeTieredCompactionMergesHottestBucket(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 4; i++ {
+		s.flush(0, 100, fmt.Sprint("small", i))
+	}
+	for i := 0; i < 4; i++ {
+		s.flush(1000, 3000, fmt.Sprint("large", i))
+	}
+	// Reading the large tables makes their bucket the hottest.
+	s.checkRange(1000, 3000, "large3")
+
+	c := NewCompactor(s.m, Options{Style: StyleSizeTiered, MinThreshold: 4, MinSSTableSize: 1})
+	j := c.pickSizeTieredCompaction()
+	if j == nil || len(j.inputs) != 4 {
+		t.Fatal("no bucket picked")
+	}
+	for _, sst := range j.inputs {
+		if sst.Smallest() != testKey(1000) {
+			t.Fatal("picked the cold bucket over the one that was read")
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package compaction
+
+import (
+	"sort"
+)
+
+// subcompactionBoundaries picks up to MaxSubcompactions-1 keys that split the
+// job into key ranges of roughly equal input size. Tiered jobs, which must
+// produce a single table, and small jobs are not split.
+func (c *Compactor) subcompactionBoundaries(j *job) []string {
+	if c.opts.MaxSubcompactions <= 1 || j.singleOutput || len(j.inputs) < 2 {
+		return nil
+	}
+
+	total := totalSize(j.inputs)
+	if total < 2*c.opts.TargetFileSize {
+		return nil
+	}
+
+	// Candidate split points are the first keys of the inputs. Each input's
+	// bytes are attributed to the range starting at its first key.
+	sizes := make(map[string]int64)
+	for _, sst := range j.inputs {
+		sizes[sst.Smallest()] += sst.Size()
+	}
+	keys := make([]string, 0, len(sizes))
+	for key := range sizes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ranges := c.opts.MaxSubcompactions
+	if ranges > len(keys) {
+		ranges = len(keys)
+	}
+	perRange := total / int64(ranges)
+
+	var boundaries []string
+	accumulated := sizes[keys[0]]
+	for _, key := range keys[1:] {
+		if len(boundaries) == ranges-1 {
+			break
+		}
+		if accumulated >= perRange*int64(len(boundaries)+1) {
+			boundaries = append(boundaries, key)
+		}
+		accumulated += sizes[key]
+	}
+	return boundaries
+}
@@ -0,0 +1,55 @@
+package compaction
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// flushStaggered flushes level 0 tables starting at different keys, so a
+// compaction of them has several candidate split points.
+func flushStaggered(s *testStore) {
+	for i := 0; i < 4; i++ {
+		s.flush(i*100, 400, fmt.Sprint(i))
+	}
+}
+
+func TestSubcompactionBoundaries(t *testing.T) {
+	s := newTestStore(t)
+	flushStaggered(s)
+	c := NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 4, TargetFileSize: 1024, MaxSubcompactions: 3})
+
+	j := c.pickLeveledCompaction()
+	boundaries := c.subcompactionBoundaries(j)
+	if len(boundaries) == 0 || len(boundaries) > 2 || !sort.StringsAreSorted(boundaries) {
+		t.Fatalf("boundaries %q, want up to 2 sorted keys", boundaries)
+	}
+
+	j.singleOutput = true
+	if boundaries := c.subcompactionBoundaries(j); boundaries != nil {
+		t.Fatalf("single output job split at %q", boundaries)
+	}
+	j.singleOutput = false
+	c.opts.MaxSubcompactions = 1
+	if boundaries := c.subcompactionBoundaries(j); boundaries != nil {
+		t.Fatalf("job split at %q with subcompactions disabled", boundaries)
+	}
+}
+
+func TestSubcompactions(t *testing.T) {
+	s := newTestStore(t)
+	flushStaggered(s)
+	c := NewCompactor(s.m, Options{Level0FileNumCompactionTrigger: 4, TargetFileSize: 1024, MaxSubcompactions: 4})
+	if boundaries := c.subcompactionBoundaries(c.pickLeveledCompaction()); len(boundaries) == 0 {
+		t.Fatal("compaction is not split")
+	}
+	s.compact(c)
+
+	if counts := s.tableCounts(); counts[0] != 0 || counts[1] == 0 {
+		t.Fatalf("tables per level %v, want everything in level 1", counts)
+	}
+	s.checkLevelsDisjoint()
+	for i := 0; i < 4; i++ {
+		s.checkRange(i*100, (i+1)*100, fmt.Sprint(i))
+	}
+}
@@ -0,0 +1,80 @@
+package compaction
+
+import (
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// Universal compaction keeps every table in level 0 as a sorted run ordered
+// by age and only ever merges runs that are adjacent in age, trading read and
+// space amplification for lower write amplification. Runs are merged when the
+// newer data grows too large relative to the oldest run (size amplification),
+// when a run of similarly sized newer runs builds up (size ratio), or, as a
+// last resort, when there are simply too many runs.
+
+// pickUniversalCompaction returns the next universal compaction, or nil if
+// the number of sorted runs is below the level 0 trigger.
+func (c *Compactor) pickUniversalCompaction() *job {
+	levels := c.snapshotLevels()
+
+	// Sorted runs, newest first.
+	runs := make([]*sstable.SSTable, len(levels[0]))
+	for i, sst := range levels[0] {
+		runs[len(runs)-1-i] = sst
+	}
+	if len(runs) < c.opts.Level0FileNumCompactionTrigger || len(runs) < 2 {
+		return nil
+	}
+
+	inputs := c.pickBySizeAmplification(runs)
+	if inputs == nil {
+		inputs = c.pickBySizeRatio(runs)
+	}
+	if inputs == nil {
+		inputs = runs[:len(runs)-c.opts.Level0FileNumCompactionTrigger+1]
+		if len(inputs) < 2 {
+			inputs = runs[:2]
+		}
+	}
+
+	return &job{
+		level:        0,
+		outputLevel:  0,
+		inputs:       inputs,
+		levels:       levels,
+		singleOutput: true,
+	}
+}
+
+// pickBySizeAmplification merges every run when the runs newer than the
+// oldest one add up to more than MaxSizeAmplificationPercent of it.
+func (c *Compactor) pickBySizeAmplification(runs []*sstable.SSTable) []*sstable.SSTable {
+	oldest := runs[len(runs)-1].Size()
+	newer := totalSize(runs[:len(runs)-1])
+	if oldest == 0 || newer*100 <= oldest*int64(c.opts.MaxSizeAmplificationPercent) {
+		return nil
+	}
+	return runs
+}
+
+// pickBySizeRatio looks, starting from each run in turn, for the longest
+// stretch of older runs where every next run is no more than SizeRatio
+// percent larger than everything collected so far.
+func (c *Compactor) pickBySizeRatio(runs []*sstable.SSTable) []*sstable.SSTable {
+	for start := 0; start < len(runs)-1; start++ {
+		candidateSize := runs[start].Size()
+		end := start + 1
+		for ; end < len(runs); end++ {
+			if c.opts.MaxMergeWidth > 0 && end-start >= c.opts.MaxMergeWidth {
+				break
+			}
+			if candidateSize*int64(100+c.opts.SizeRatio)/100 < runs[end].Size() {
+				break
+			}
+			candidateSize += runs[end].Size()
+		}
+		if end-start >= c.opts.MinMergeWidth {
+			return runs[start:end]
+		}
+	}
+	return nil
+}
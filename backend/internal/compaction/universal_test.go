@@ -0,0 +1,74 @@
+package compaction
+
+import "testing"
+
+func TestManualUniversalCompactionMergesAdjacentRuns(t *testing.T) {
+	s := newTestStore(t)
+	s.flush(0, 10, "old")
+	s.flush(100, 110, "middle")
+	s.flush(0, 10, "new")
+	s.flush(200, 210, "newest")
+
+	c := NewCompactor(s.m, Options{Style: StyleUniversal})
+	if err := c.CompactRange(testKey(0), testKey(9), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The middle run lies outside the range but between the two runs that
+	// overlap it, so it is merged with them.
+	runs := s.m.Levels()[0]
+	if len(runs) != 2 {
+		t.Fatalf("%d runs left, want 2", len(runs))
+	}
+	for i := 1; i < len(runs); i++ {
+		if prev := runs[i-1].Properties(); prev.MaxSeq >= runs[i].Properties().MinSeq {
+			t.Fatalf("runs %d and %d have overlapping sequence numbers", i-1, i)
+		}
+	}
+	s.checkRange(0, 10, "new")
+	s.checkRange(100, 110, "middle")
+	s.checkRange(200, 210, "newest")
+}
+
+func TestUniversalCompaction(t *testing.T) {
+	tests := []struct {
+		name string
+		// runs is the number of keys in each run, oldest first.
+		runs []int
+		want int // runs left
+	}{
+		{"below trigger", []int{100, 100, 100}, 3},
+		// The newer runs are far larger than the oldest, so all are merged.
+		{"size amplification", []int{10, 100, 100, 100}, 1},
+		// The newer runs are similar in size and merged without the oldest.
+		{"size ratio", []int{5000, 100, 100, 100, 100}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestStore(t)
+			from := 0
+			for _, n := range test.runs {
+				s.flush(from, from+n, "v")
+				from += n
+			}
+			s.compact(NewCompactor(s.m, Options{
+				Style:                          StyleUniversal,
+				Level0FileNumCompactionTrigger: 4,
+				MaxSizeAmplificationPercent:    200,
+				// Leave room for runs of equal data to differ in their metadata.
+				SizeRatio: 10,
+			}))
+
+			runs := s.m.Levels()[0]
+			if len(runs) != test.want {
+				t.Fatalf("%d runs left, want %d", len(runs), test.want)
+			}
+			for i := 1; i < len(runs); i++ {
+				if runs[i-1].MaxSeq() >= runs[i].Properties().MinSeq {
+					t.Fatalf("runs %d and %d have overlapping sequence numbers", i-1, i)
+				}
+			}
+			s.checkRange(0, from, "v")
+		})
+	}
+}
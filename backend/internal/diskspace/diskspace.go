@@ -0,0 +1,20 @@
+package diskspace
+
+import "errors"
+
+// ErrNoSpace is returned when an operation would leave less free disk space
+// than the store reserves.
+var ErrNoSpace = errors.New("not enough free disk space")
+
+// Free returns the space that can still be used on the filesystem holding
+// dir once reserved bytes are set aside. It never returns less than zero.
+func Free(dir string, reserved int64) (int64, error) {
+	available, err := Available(dir)
+	if err != nil {
+		return 0, err
+	}
+	if available <= reserved {
+		return 0, nil
+	}
+	return available - reserved, nil
+}
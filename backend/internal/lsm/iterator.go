@@ -0,0 +1,220 @@
+package lsm
+
+import (
+	"container/heap"
+	"strings"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/memtable"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/tree"
+)
+
+type IteratorOptions struct {
+	// Start and End bound the iteration to the keys in [Start, End). An empty
+	// End leaves the range open.
+	Start string
+	End   string
+
+	// Prefix restricts the iteration to keys starting with Prefix, on top of
+	// Start and End. If Prefix is a whole prefix under
+	// Options.Table.PrefixExtractor, SSTables whose prefix filter rules it out
+	// are not read at all.
+	Prefix string
+}
+
+// Iterator walks the live keys of the tree in order, merging the memtables
+// and SSTables as they were when it was created. Later writes are not seen.
+type Iterator struct {
+	sources []source
+	heap    sourceHeap
+	prefix  string
+	key     string
+	value   string
+	valid   bool
+	err     error
+}
+
+// source is a sorted stream of entries, either a memtable snapshot or an
+// SSTable scanner.
+type source interface {
+	HasNext() bool
+	Peek() sstable.Entry
+	Next() sstable.Entry
+	Err() error
+	Close() error
+}
+
+// NewIterator returns an iterator positioned at the first live key in range.
+func (lsm *LSMTree) NewIterator(opts IteratorOptions) *Iterator {
+	start, end := opts.Start, opts.End
+	if opts.Prefix != "" {
+		if opts.Prefix > start {
+			start = opts.Prefix
+		}
+		if successor := sstable.PrefixSuccessor(opts.Prefix); successor != "" && (end == "" || successor < end) {
+			end = successor
+		}
+	}
+
+	it := &Iterator{prefix: opts.Prefix}
+
+	lsm.mutex.RLock()
+	it.sources = append(it.sources, snapshotMemtable(lsm.memtable, start, end))
+	for i := len(lsm.immutables) - 1; i >= 0; i-- {
+		it.sources = append(it.sources, snapshotMemtable(lsm.immutables[i].memtable, start, end))
+	}
+	scanners, err := lsm.sstableManager.NewScanners(start, end, opts.Prefix)
+	for _, scanner := range scanners {
+		it.sources = append(it.sources, scanner)
+	}
+	lsm.mutex.RUnlock()
+	if err != nil {
+		it.Close()
+		it.sources, it.err = nil, err
+		return it
+	}
+
+	for _, src := range it.sources {
+		if src.HasNext() {
+			it.heap = append(it.heap, src)
+		}
+	}
+	heap.Init(&it.heap)
+	it.Next()
+	return it
+}
+
+func (it *Iterator) Valid() bool {
+	return it.valid
+}
+
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+func (it *Iterator) Value() string {
+	return it.value
+}
+
+// Next moves to the next live key. Older versions of a key and deleted keys
+// are skipped.
+func (it *Iterator) Next() {
+	for it.heap.Len() > 0 {
+		newest := it.pop()
+		for it.heap.Len() > 0 && it.heap[0].Peek().Key == newest.Key {
+			it.pop()
+		}
+
+		if !newest.Deleted && strings.HasPrefix(newest.Key, it.prefix) {
+			it.key, it.value, it.valid = newest.Key, newest.Value, true
+			return
+		}
+	}
+
+	it.valid = false
+	for _, src := range it.sources {
+		if err := src.Err(); err != nil && it.err == nil {
+			it.err = err
+		}
+	}
+}
+
+func (it *Iterator) pop() sstable.Entry {
+	src := heap.Pop(&it.heap).(source)
+	entry := src.Next()
+	if src.HasNext() {
+		heap.Push(&it.heap, src)
+	}
+	return entry
+}
+
+// Err returns the first error hit while reading, once the iterator is
+// exhausted.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Close() error {
+	var firstErr error
+	for _, src := range it.sources {
+		if err := src.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// memtableSnapshot holds a copy of the entries of a memtable in a key range.
+type memtableSnapshot struct {
+	entries []sstable.Entry
+}
+
+func snapshotMemtable(m *memtable.Memtable, start, end string) *memtableSnapshot {
+	snapshot := &memtableSnapshot{}
+	m.InOrderTraversal(func(key tree.Comparable, value interface{}) {
+		k := key.(tree.StringComparable).Value
+		if k < start || (end != "" && k >= end) {
+			return
+		}
+		entry := value.(memtable.Entry)
+		snapshot.entries = append(snapshot.entries, sstable.Entry{
+			Key:     k,
+			Value:   entry.Value,
+			Seq:     entry.Seq,
+			Deleted: entry.Deleted,
+		})
+	})
+	return snapshot
+}
+
+func (s *memtableSnapshot) HasNext() bool {
+	return len(s.entries) > 0
+}
+
+func (s *memtableSnapshot) Peek() sstable.Entry {
+	return s.entries[0]
+}
+
+func (s *memtableSnapshot) Next() sstable.Entry {
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	return entry
+}
+
+func (s *memtableSnapshot) Err() error {
+	return nil
+}
+
+func (s *memtableSnapshot) Close() error {
+	return nil
+}
+
+// sourceHeap orders sources by their next key and, for equal keys, puts the
+// newest version first.
+type sourceHeap []source
+
+func (h sourceHeap) Len() int { return len(h) }
+
+func (h sourceHeap) Less(i, j int) bool {
+	a, b := h[i].Peek(), h[j].Peek()
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.Seq > b.Seq
+}
+
+func (h sourceHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *sourceHeap) Push(x interface{}) {
+	*h = append(*h, x.(source))
+}
+
+func (h *sourceHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[0 : n-1]
+	return item
+}
@@ -0,0 +1,70 @@
+package lsm
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+// scan returns the keys and values an iterator with opts walks over.
+func scan(t *testing.T, tree *LSMTree, opts IteratorOptions) []string {
+	t.Helper()
+	it := tree.NewIterator(opts)
+	defer it.Close()
+	var got []string
+	for ; it.Valid(); it.Next() {
+		got = append(got, it.Key()+"="+it.Value())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestPrefixIterator(t *testing.T) {
+	tree := openTestTree(t, func(opts *Options) {
+		opts.Table.PrefixExtractor = sstable.NewDelimitedPrefixExtractor("/", 1)
+	})
+	put := func(key, value string) {
+		t.Helper()
+		if err := tree.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Versions of the keys spread over two tables and the memtable.
+	for _, tenant := range []string{"a", "b", "bb", "c"} {
+		for i := 0; i < 3; i++ {
+			put(fmt.Sprintf("%s/%d", tenant, i), "old")
+		}
+	}
+	if err := tree.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	put("b/1", "new")
+	if err := tree.Delete("b/2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	put("b/3", "newest")
+
+	tests := []struct {
+		opts IteratorOptions
+		want []string
+	}{
+		{IteratorOptions{Prefix: "b/"}, []string{"b/0=old", "b/1=new", "b/3=newest"}},
+		{IteratorOptions{Prefix: "b/", Start: "b/1"}, []string{"b/1=new", "b/3=newest"}},
+		{IteratorOptions{Prefix: "b/", End: "b/3"}, []string{"b/0=old", "b/1=new"}},
+		{IteratorOptions{Prefix: "b"}, []string{"b/0=old", "b/1=new", "b/3=newest", "bb/0=old", "bb/1=old", "bb/2=old"}},
+		{IteratorOptions{Prefix: "d/"}, nil},
+	}
+	for _, test := range tests {
+		if got := scan(t, tree, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("%+v: got %q, want %q", test.opts, got, test.want)
+		}
+	}
+}
@@ -1,126 +1,423 @@
 package lsm
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
 	"github.com/ashmitsharp/lsm-tree/backend/internal/compaction"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/diskspace"
 	"github.com/ashmitsharp/lsm-tree/backend/internal/memtable"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/ratelimit"
 	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
 	"github.com/ashmitsharp/lsm-tree/backend/internal/tree"
 	"github.com/ashmitsharp/lsm-tree/backend/internal/wal"
 )
 
+// ErrNoSpace is returned by writes while free disk space is below
+// Options.Compaction.ReservedDiskSpace.
+var ErrNoSpace = diskspace.ErrNoSpace
+
+// immutableMemtable is a memtable waiting to be flushed together with the WAL
+// segment that can be released once it is.
+type immutableMemtable struct {
+	memtable   *memtable.Memtable
+	walSegment uint64
+}
+
 type LSMTree struct {
+	opts           Options
 	memtable       *memtable.Memtable
+	immutables     []immutableMemtable
 	sstableManager *sstable.SSTableManager
 	wal            *wal.WAL
 	compactor      *compaction.Compactor
 	flushChan      chan *memtable.Memtable
+	closeChan      chan struct{}
+	lastSeq        uint64
+	bgError        error
+	flushMutex     sync.Mutex
 	mutex          sync.RWMutex
 }
 
+// flushCheckInterval is how often free disk space and the memtable age are
+// checked, the latter against Options.MemtableFlushPeriod.
+const flushCheckInterval = time.Second
+
 func NewLSMTree() (*LSMTree, error) {
+	return NewLSMTreeWithOptions(DefaultOptions())
+}
+
+func NewLSMTreeWithOptions(opts Options) (*LSMTree, error) {
+	opts = opts.withDefaults()
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
 	flushChan := make(chan *memtable.Memtable, 1)
-	sstableManager := sstable.NewSSTableManager()
-	walLog, err := wal.NewWAL("lsm.log")
+	sstableManager := sstable.NewSSTableManager(opts.Dir, opts.Table)
+	sstableManager.SetRateLimiter(opts.RateLimiter)
+	if err := sstableManager.Load(); err != nil {
+		return nil, err
+	}
+	walLog, err := wal.NewWAL(filepath.Join(opts.Dir, "wal"))
 	if err != nil {
 		return nil, err
 
 	}
 
 	lsm := &LSMTree{
-		memtable:       memtable.NewMemTable(1024*1024, flushChan),
+		opts:           opts,
 		sstableManager: sstableManager,
 		wal:            walLog,
-		compactor:      compaction.NewCompactor(sstableManager, 4, 1000000),
+		compactor:      compaction.NewCompactor(sstableManager, opts.Compaction),
 		flushChan:      flushChan,
+		closeChan:      make(chan struct{}),
+		lastSeq:        sstableManager.LastSequence(),
 	}
+	lsm.memtable = lsm.newMemtable()
 
+	// Failed compactions stop writes like failed flushes. Running out of
+	// space is lifted again by checkDiskSpace.
+	lsm.compactor.SetErrorHandler(lsm.setBackgroundError)
 	go lsm.Run()
 	lsm.compactor.Start()
 
 	return lsm, nil
 }
 
+func (lsm *LSMTree) newMemtable() *memtable.Memtable {
+	m := memtable.NewMemTable(lsm.opts.MemtableSize, lsm.flushChan)
+	if lsm.opts.WriteBufferManager != nil {
+		lsm.opts.WriteBufferManager.Register(m)
+	}
+	return m
+}
+
 func (lsm *LSMTree) Put(key, value string) error {
 	lsm.mutex.Lock()
 	defer lsm.mutex.Unlock()
 
+	if lsm.bgError != nil {
+		return lsm.bgError
+	}
 	if err := lsm.wal.AppendPut(key, value); err != nil {
 		return err
 	}
 
-	lsm.memtable.Put(tree.StringComparable{Value: key}, value)
+	lsm.lastSeq++
+	lsm.memtable.Put(tree.StringComparable{Value: key}, value, lsm.lastSeq)
+	lsm.sstableManager.InvalidateRow(key, lsm.lastSeq)
+	lsm.checkWALSize()
 	return nil
 }
 
-func (lsm *LSMTree) Get(key string) (string, bool) {
-	lsm.mutex.Lock()
-	defer lsm.mutex.Unlock()
+// Get returns the value of key. An error means an SSTable that may hold the
+// key could not be read.
+func (lsm *LSMTree) Get(key string) (string, bool, error) {
+	lsm.mutex.RLock()
+	defer lsm.mutex.RUnlock()
+
+	if entry, found := lsm.memtable.Get(tree.StringComparable{Value: key}); found {
+		return entry.Value, !entry.Deleted, nil
+	}
 
-	if value, found := lsm.memtable.Get(tree.StringComparable{Value: key}); found {
-		return value.(string), true
+	for i := len(lsm.immutables) - 1; i >= 0; i-- {
+		if entry, found := lsm.immutables[i].memtable.Get(tree.StringComparable{Value: key}); found {
+			return entry.Value, !entry.Deleted, nil
+		}
 	}
 
-	return lsm.sstableManager.Read(key)
+	return lsm.sstableManager.Read(key, lsm.lastSeq)
 }
 
 func (lsm *LSMTree) Delete(key string) error {
 	lsm.mutex.Lock()
 	defer lsm.mutex.Unlock()
 
+	if lsm.bgError != nil {
+		return lsm.bgError
+	}
 	if err := lsm.wal.AppendDelete(key); err != nil {
 		return err
 	}
 
-	lsm.memtable.Delete(tree.StringComparable{Value: key})
+	lsm.lastSeq++
+	lsm.memtable.Delete(tree.StringComparable{Value: key}, lsm.lastSeq)
+	lsm.sstableManager.InvalidateRow(key, lsm.lastSeq)
+	lsm.checkWALSize()
 	return nil
 }
 
-func (lsm *LSMTree) FlushMemtable() error {
+// checkWALSize requests a flush of the active memtable once the WAL has grown
+// past Options.MaxTotalWALSize. Callers must hold the tree mutex.
+func (lsm *LSMTree) checkWALSize() {
+	if lsm.opts.MaxTotalWALSize > 0 && lsm.wal.TotalSize() > lsm.opts.MaxTotalWALSize {
+		lsm.memtable.RequestFlush()
+	}
+}
+
+// checkMemtableAge requests a flush of the active memtable once its oldest
+// write is older than Options.MemtableFlushPeriod.
+func (lsm *LSMTree) checkMemtableAge() {
+	if lsm.opts.MemtableFlushPeriod <= 0 {
+		return
+	}
+
+	lsm.mutex.RLock()
+	m := lsm.memtable
+	lsm.mutex.RUnlock()
+
+	if m.Age() >= lsm.opts.MemtableFlushPeriod {
+		m.RequestFlush()
+	}
+}
+
+// Flush writes the active memtable to an SSTable. If wait is false the flush
+// runs in the background and Flush returns immediately.
+func (lsm *LSMTree) Flush(wait bool) error {
+	lsm.mutex.RLock()
+	m := lsm.memtable
+	lsm.mutex.RUnlock()
+
+	if !wait {
+		go lsm.flushMemtable(m)
+		return nil
+	}
+	return lsm.flushMemtable(m)
+}
+
+// flushMemtable swaps m out for a fresh memtable and writes it to an SSTable.
+// Reads keep seeing m through the immutable list until the SSTable is in
+// place. Requests for a memtable that is no longer active are ignored, but
+// still retry immutable memtables left behind by an earlier failed flush. If
+// the WAL cannot be rotated, m stays active and takes flush requests again,
+// and the error stops writes like a failed flush.
+//
+// Flushes are serialized so WAL segments are released in order.
+func (lsm *LSMTree) flushMemtable(m *memtable.Memtable) error {
+	lsm.flushMutex.Lock()
+	defer lsm.flushMutex.Unlock()
+
+	lsm.mutex.Lock()
+	if m == lsm.memtable && !m.Empty() {
+		segment, err := lsm.wal.Rotate()
+		if err != nil {
+			m.CancelFlush()
+			lsm.mutex.Unlock()
+			lsm.setBackgroundError(err)
+			return err
+		}
+		m.MarkImmutable()
+		lsm.immutables = append(lsm.immutables, immutableMemtable{memtable: m, walSegment: segment})
+		lsm.memtable = lsm.newMemtable()
+	}
+	lsm.mutex.Unlock()
+
+	return lsm.flushImmutables()
+}
+
+// flushImmutables writes the immutable memtables to SSTables, oldest first.
+// On failure the remaining memtables stay readable and their WAL segments are
+// kept; the error becomes the background error that rejects writes.
+// Callers must hold the flush mutex.
+func (lsm *LSMTree) flushImmutables() error {
+	for {
+		lsm.mutex.RLock()
+		if len(lsm.immutables) == 0 {
+			lsm.mutex.RUnlock()
+			return nil
+		}
+		imm := lsm.immutables[0]
+		lsm.mutex.RUnlock()
+
+		var entries []sstable.Entry
+		imm.memtable.InOrderTraversal(func(key tree.Comparable, value interface{}) {
+			entry := value.(memtable.Entry)
+			entries = append(entries, sstable.Entry{
+				Key:     key.(tree.StringComparable).Value,
+				Value:   entry.Value,
+				Seq:     entry.Seq,
+				Deleted: entry.Deleted,
+			})
+		})
+
+		if err := lsm.sstableManager.CreateSSTable(entries, imm.memtable.MaxSeq(), imm.memtable.NewestWrite()); err != nil {
+			lsm.setBackgroundError(err)
+			return err
+		}
+		lsm.compactor.Notify()
+
+		lsm.mutex.Lock()
+		lsm.immutables = lsm.immutables[1:]
+		lsm.mutex.Unlock()
+
+		imm.memtable.Release()
+		if err := lsm.wal.Release(imm.walSegment); err != nil {
+			return err
+		}
+	}
+}
+
+func (lsm *LSMTree) setBackgroundError(err error) {
 	lsm.mutex.Lock()
 	defer lsm.mutex.Unlock()
+	if lsm.bgError == nil {
+		lsm.bgError = err
+	}
+}
 
-	data := make(map[string]string)
-	lsm.memtable.InOrderTraversal(func(key tree.Comparable, value interface{}) {
-		strKey := key.(tree.StringComparable)
-		data[string(strKey.Value)] = value.(string)
-	})
+// BackgroundError returns the error that currently stops the tree from
+// accepting writes, or nil.
+func (lsm *LSMTree) BackgroundError() error {
+	lsm.mutex.RLock()
+	defer lsm.mutex.RUnlock()
+	return lsm.bgError
+}
 
-	err := lsm.sstableManager.CreateSSTable(data)
+// checkDiskSpace stops writes once free space in the data directory drops
+// below the reserved amount, and lifts a disk space background error again
+// once space has been freed, retrying any flush that failed for lack of it.
+func (lsm *LSMTree) checkDiskSpace() {
+	free, err := diskspace.Free(lsm.opts.Dir, lsm.opts.Compaction.ReservedDiskSpace)
 	if err != nil {
+		return
+	}
+
+	if free == 0 {
+		lsm.setBackgroundError(ErrNoSpace)
+		return
+	}
+
+	lsm.mutex.Lock()
+	recovered := lsm.bgError != nil && isNoSpace(lsm.bgError)
+	if recovered {
+		lsm.bgError = nil
+	}
+	lsm.mutex.Unlock()
+
+	if recovered {
+		lsm.flushMutex.Lock()
+		lsm.flushImmutables()
+		lsm.flushMutex.Unlock()
+		lsm.compactor.Notify()
+	}
+}
+
+func isNoSpace(err error) bool {
+	return errors.Is(err, diskspace.ErrNoSpace) || errors.Is(err, syscall.ENOSPC)
+}
+
+// CompactRange flushes the memtable and compacts every SSTable overlapping
+// [start, end] down to the bottom level, using up to maxJobs parallel jobs.
+// An empty start or end leaves that side of the range open.
+func (lsm *LSMTree) CompactRange(start, end string, maxJobs int) error {
+	if err := lsm.Flush(true); err != nil {
 		return err
 	}
+	return lsm.compactor.CompactRange(start, end, maxJobs)
+}
 
-	lsm.memtable = memtable.NewMemTable(1024*1024*1024, lsm.flushChan)
-	return nil
+func (lsm *LSMTree) CompactionProgress() compaction.RangeProgress {
+	return lsm.compactor.RangeProgress()
+}
+
+func (lsm *LSMTree) TableProperties() []sstable.TableInfo {
+	return lsm.sstableManager.TableProperties()
+}
+
+func (lsm *LSMTree) CompactionFilterStats() compaction.FilterStats {
+	return lsm.compactor.FilterStats()
+}
+
+// PendingCompactionBytes estimates how far compaction is behind.
+func (lsm *LSMTree) PendingCompactionBytes() int64 {
+	return lsm.compactor.PendingCompactionBytes()
+}
+
+// RateLimiterStats reports the I/O let through the rate limiter and the time
+// flushes and compactions spent throttled. It is zero without a limiter.
+func (lsm *LSMTree) RateLimiterStats() ratelimit.Stats {
+	if lsm.opts.RateLimiter == nil {
+		return ratelimit.Stats{}
+	}
+	return lsm.opts.RateLimiter.Stats()
+}
+
+// BlockCacheStats reports the usage and hit rate of the block cache, which
+// includes other stores sharing it. It is zero without a cache.
+func (lsm *LSMTree) BlockCacheStats() cache.Stats {
+	if lsm.opts.Table.BlockCache == nil {
+		return cache.Stats{}
+	}
+	return lsm.opts.Table.BlockCache.Stats()
+}
+
+// RowCacheStats reports the usage and hit rate of the row cache, which
+// includes other stores sharing it. It is zero without a cache.
+func (lsm *LSMTree) RowCacheStats() cache.Stats {
+	if lsm.opts.Table.RowCache == nil {
+		return cache.Stats{}
+	}
+	return lsm.opts.Table.RowCache.Stats()
 }
 
 func (lsm *LSMTree) Run() {
+	ticker := time.NewTicker(flushCheckInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-lsm.flushChan:
-			lsm.FlushMemtable()
+		case m := <-lsm.flushChan:
+			lsm.flushMemtable(m)
+		case <-ticker.C:
+			lsm.checkMemtableAge()
+			lsm.checkDiskSpace()
+		case <-lsm.closeChan:
+			return
 		}
 	}
 }
 
 func (lsm *LSMTree) Close() error {
+	// The compactor reports errors under the tree mutex, so it is stopped
+	// before the mutex is taken.
+	lsm.compactor.Stop()
+
 	lsm.mutex.Lock()
 	defer lsm.mutex.Unlock()
 
-	lsm.compactor.Stop()
+	close(lsm.closeChan)
+	// Memtables still registered with a shared write buffer manager would
+	// otherwise keep their memory reserved after the store is gone.
+	lsm.memtable.Release()
+	for _, imm := range lsm.immutables {
+		imm.memtable.Release()
+	}
+	if err := lsm.sstableManager.Close(); err != nil {
+		return err
+	}
 	return lsm.wal.Close()
 }
 
 func (lsm *LSMTree) Recover() error {
+	lsm.mutex.Lock()
+	defer lsm.mutex.Unlock()
+
 	return lsm.wal.Replay(func(opType uint8, key, value string) error {
 		switch opType {
 		case 1:
-			lsm.memtable.Put(tree.StringComparable{Value: key}, value)
+			lsm.lastSeq++
+			lsm.memtable.Put(tree.StringComparable{Value: key}, value, lsm.lastSeq)
 		case 2:
-			lsm.memtable.Delete(tree.StringComparable{Value: key})
+			lsm.lastSeq++
+			lsm.memtable.Delete(tree.StringComparable{Value: key}, lsm.lastSeq)
 		}
+		lsm.sstableManager.InvalidateRow(key, lsm.lastSeq)
 		return nil
 	})
 }
@@ -0,0 +1,233 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/diskspace"
+)
+
+// openTestTree opens a tree in a temporary directory. Background compaction
+// is kept out of the way unless configure asks for it.
+func openTestTree(t *testing.T, configure func(*Options)) *LSMTree {
+	t.Helper()
+	opts := DefaultOptions()
+	opts.Dir = t.TempDir()
+	opts.Table.BlockCache = nil
+	opts.Compaction.Level0FileNumCompactionTrigger = 100
+	if configure != nil {
+		configure(&opts)
+	}
+	tree, err := NewLSMTreeWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tree.Close() })
+	return tree
+}
+
+func mustGet(t *testing.T, tree *LSMTree, key string) (string, bool) {
+	t.Helper()
+	value, found, err := tree.Get(key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	return value, found
+}
+
+func TestGetReportsUnreadableTables(t *testing.T) {
+	tree := openTestTree(t, nil)
+	for _, value := range []string{"old", "new"} {
+		if err := tree.Put("key", value); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Flush(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, _ := mustGet(t, tree, "key"); value != "new" {
+		t.Fatalf("got %q, want new", value)
+	}
+
+	// Damage the first data block of the newest table.
+	newest := 0
+	for _, info := range tree.TableProperties() {
+		newest = max(newest, info.Number)
+	}
+	filename := filepath.Join(tree.opts.Dir, fmt.Sprintf("sstable_%d.db", newest))
+	file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt(bytes.Repeat([]byte{0xff}, 16), 0)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, found, err := tree.Get("key")
+	if err == nil {
+		t.Fatalf("got %q, %v from a tree with a damaged newest table", value, found)
+	}
+}
+
+func TestWritesRejectedOnlyBelowReservedSpace(t *testing.T) {
+	if free, err := diskspace.Free(t.TempDir(), 0); err != nil || free == math.MaxInt64 {
+		t.Skip("free disk space is unknown")
+	}
+
+	full := openTestTree(t, func(opts *Options) {
+		opts.Compaction.ReservedDiskSpace = math.MaxInt64
+	})
+	full.checkDiskSpace()
+	if err := full.Put("key", "value"); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("put with no space left: got %v, want ErrNoSpace", err)
+	}
+
+	// A compaction postponed for space, or one that ran out of it, does not
+	// keep writes from resuming while space is above the reserve.
+	tree := openTestTree(t, nil)
+	tree.setBackgroundError(ErrNoSpace)
+	tree.checkDiskSpace()
+	if err := tree.Put("key", "value"); err != nil {
+		t.Fatalf("put with space above the reserve: %v", err)
+	}
+	if err := tree.BackgroundError(); err != nil {
+		t.Fatalf("background error %v with space above the reserve", err)
+	}
+}
+
+func TestFailedWALRotateIsReportedAndRetried(t *testing.T) {
+	tree := openTestTree(t, nil)
+	if err := tree.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in place of the next WAL segment keeps it from being created.
+	walDir := filepath.Join(tree.opts.Dir, "wal")
+	segments, err := filepath.Glob(filepath.Join(walDir, "*.log"))
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("WAL segments %v, %v", segments, err)
+	}
+	var current int
+	fmt.Sscanf(filepath.Base(segments[0]), "%d.log", &current)
+	blocker := filepath.Join(walDir, fmt.Sprintf("%06d.log", current+1))
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tree.memtable.RequestFlush()
+	if err := tree.Flush(true); err == nil {
+		t.Fatal("flush succeeded without a new WAL segment")
+	}
+	if tree.BackgroundError() == nil {
+		t.Fatal("failed WAL rotation not reported")
+	}
+	if !tree.memtable.Flushable() {
+		t.Fatal("memtable still marked as queued for a flush that failed")
+	}
+	if value, found := mustGet(t, tree, "key"); !found || value != "value" {
+		t.Fatalf("got %q, %v after a failed flush", value, found)
+	}
+}
+
+// waitForFlush waits for the background flush of a memtable to an SSTable.
+func waitForFlush(t *testing.T, tree *LSMTree) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if len(tree.TableProperties()) > 0 {
+			return
+		}
+	}
+	t.Fatal("memtable was not flushed")
+}
+
+func TestFlushTriggers(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Options)
+		// trigger runs after the writes, for triggers checked periodically.
+		trigger func(*LSMTree)
+	}{
+		{"memtable size", func(opts *Options) { opts.MemtableSize = 1024 }, nil},
+		{"WAL size", func(opts *Options) { opts.MaxTotalWALSize = 1024 }, nil},
+		{"memtable age", func(opts *Options) { opts.MemtableFlushPeriod = time.Millisecond }, func(tree *LSMTree) {
+			time.Sleep(2 * time.Millisecond)
+			tree.checkMemtableAge()
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := openTestTree(t, func(opts *Options) {
+				opts.MemtableSize = 1 << 30
+				test.configure(opts)
+			})
+			for i := 0; i < 100; i++ {
+				if err := tree.Put(fmt.Sprintf("key%03d", i), "value"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.trigger != nil {
+				test.trigger(tree)
+			}
+			waitForFlush(t, tree)
+			if value, found := mustGet(t, tree, "key050"); !found || value != "value" {
+				t.Fatalf("got %q, %v after the flush", value, found)
+			}
+		})
+	}
+}
+
+func TestNoFlushWithoutTrigger(t *testing.T) {
+	tree := openTestTree(t, func(opts *Options) {
+		opts.MemtableSize = 1 << 30
+		opts.MemtableFlushPeriod = time.Hour
+	})
+	if err := tree.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	tree.checkMemtableAge()
+	time.Sleep(50 * time.Millisecond)
+	if tables := tree.TableProperties(); len(tables) > 0 {
+		t.Fatalf("%d tables flushed without a trigger", len(tables))
+	}
+}
+
+func TestRowCacheSeesNewerWrites(t *testing.T) {
+	rowCache := cache.NewCache(1<<20, cache.LRU)
+	tree := openTestTree(t, func(opts *Options) { opts.Table.RowCache = rowCache })
+
+	for _, value := range []string{"old", "new"} {
+		if err := tree.Put("key", value); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Flush(true); err != nil {
+			t.Fatal(err)
+		}
+		// The second read is served by the row cache.
+		for i := 0; i < 2; i++ {
+			if got, found := mustGet(t, tree, "key"); !found || got != value {
+				t.Fatalf("got %q, %v, want %q", got, found, value)
+			}
+		}
+	}
+	if err := tree.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	if got, found := mustGet(t, tree, "key"); found {
+		t.Fatalf("got %q for a deleted key", got)
+	}
+	if stats := tree.RowCacheStats(); stats.Hits < 2 {
+		t.Fatalf("row cache stats %+v", stats)
+	}
+}
@@ -0,0 +1,66 @@
+package lsm
+
+import (
+	"time"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/compaction"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/memtable"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/ratelimit"
+	"github.com/ashmitsharp/lsm-tree/backend/internal/sstable"
+)
+
+type Options struct {
+	// Dir holds the WAL and SSTable files of the store.
+	Dir string
+
+	// MemtableSize is the size in bytes at which a memtable is flushed.
+	MemtableSize int64
+
+	// MemtableFlushPeriod flushes a memtable once its oldest write is older
+	// than this, so idle stores do not keep data only in the WAL. Zero
+	// disables it.
+	MemtableFlushPeriod time.Duration
+
+	// MaxTotalWALSize flushes the active memtable once the WAL segments
+	// still needed for recovery grow past this many bytes. Zero disables it.
+	MaxTotalWALSize int64
+
+	// WriteBufferManager, if set, enforces a memory budget shared with every
+	// other store using the same manager.
+	WriteBufferManager *memtable.WriteBufferManager
+
+	// RateLimiter, if set, throttles the bytes per second written by flushes
+	// and compactions. Flushes take priority so they are not starved by
+	// compaction. The limiter may be shared between stores.
+	RateLimiter *ratelimit.RateLimiter
+
+	// Table configures how SSTables are written.
+	Table sstable.Options
+
+	// Compaction configures the background compactor.
+	Compaction compaction.Options
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Dir:                 ".",
+		MemtableSize:        1024 * 1024,
+		MemtableFlushPeriod: 30 * time.Minute,
+		MaxTotalWALSize:     16 * 1024 * 1024,
+		Table:               sstable.DefaultOptions(),
+		Compaction:          compaction.DefaultOptions(),
+	}
+}
+
+// withDefaults fills in the fields that have no usable zero value from
+// DefaultOptions. The compactor does the same for Options.Compaction.
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Dir == "" {
+		o.Dir = defaults.Dir
+	}
+	if o.MemtableSize <= 0 {
+		o.MemtableSize = defaults.MemtableSize
+	}
+	return o
+}
@@ -2,16 +2,31 @@ package memtable
 
 import (
 	"sync"
+	"time"
 
 	"github.com/ashmitsharp/lsm-tree/backend/internal/tree"
 )
 
+// Entry is the value stored for every key. Deletes are kept as tombstones so
+// they shadow older versions of the key in SSTables.
+type Entry struct {
+	Value   string
+	Seq     uint64
+	Deleted bool
+}
+
 type Memtable struct {
-	tree      tree.Tree
-	size      int64
-	maxSize   int64
-	flushChan chan<- *Memtable
-	mutex     sync.RWMutex
+	tree           tree.Tree
+	size           int64
+	maxSize        int64
+	flushChan      chan<- *Memtable
+	writeBuffer    *WriteBufferManager
+	oldestWrite    time.Time
+	newestWrite    time.Time
+	maxSeq         uint64
+	immutable      bool
+	flushRequested bool
+	mutex          sync.RWMutex
 }
 
 func NewMemTable(maxSize int64, flushChan chan<- *Memtable) *Memtable {
@@ -22,40 +37,157 @@ func NewMemTable(maxSize int64, flushChan chan<- *Memtable) *Memtable {
 	}
 }
 
-func (m *Memtable) Put(key tree.Comparable, value interface{}) bool {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+func (m *Memtable) Put(key tree.Comparable, value string, seq uint64) bool {
+	return m.insert(key, Entry{Value: value, Seq: seq})
+}
+
+func (m *Memtable) Delete(key tree.Comparable, seq uint64) bool {
+	return m.insert(key, Entry{Seq: seq, Deleted: true})
+}
 
+func (m *Memtable) insert(key tree.Comparable, entry Entry) bool {
 	stringKey, ok := key.(tree.StringComparable)
 	if !ok {
 		panic("Key must be of type StringComparable")
 	}
 
-	if m.tree.Insert(key, value) {
-		m.size += int64(stringKey.Length() + len(value.(string)))
-		if m.size >= m.maxSize {
-			m.flushChan <- m
-		}
-		return true
+	m.mutex.Lock()
+	// An overwrite replaces the old entry, so only the difference in size is
+	// accounted for.
+	delta := int64(stringKey.Length() + len(entry.Value))
+	if old, found := m.tree.Search(key); found {
+		delta -= int64(stringKey.Length() + len(old.(Entry).Value))
+	}
+	if !m.tree.Insert(key, entry) {
+		m.mutex.Unlock()
+		return false
 	}
+	m.newestWrite = time.Now()
+	if m.oldestWrite.IsZero() {
+		m.oldestWrite = m.newestWrite
+	}
+	if entry.Seq > m.maxSeq {
+		m.maxSeq = entry.Seq
+	}
+	m.size += delta
+	full := m.size >= m.maxSize
+	writeBuffer := m.writeBuffer
+	m.mutex.Unlock()
 
-	return false
+	// The write buffer manager may inspect other memtables, so it is only
+	// called once our own lock has been released.
+	if writeBuffer != nil && delta > 0 {
+		writeBuffer.ReserveMemory(delta)
+	} else if writeBuffer != nil && delta < 0 {
+		writeBuffer.FreeMemory(-delta)
+	}
+	if full {
+		m.RequestFlush()
+	}
+	return true
 }
 
-func (m *Memtable) Get(key tree.Comparable) (interface{}, bool) {
+// Get returns the entry for key, which may be a tombstone.
+func (m *Memtable) Get(key tree.Comparable) (Entry, bool) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	return m.tree.Search(key)
+	value, found := m.tree.Search(key)
+	if !found {
+		return Entry{}, false
+	}
+	return value.(Entry), true
 }
 
-func (m *Memtable) Delete(key tree.Comparable) bool {
+func (m *Memtable) InOrderTraversal(visit func(key tree.Comparable, value interface{})) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	return m.tree.Delete(key)
+	m.tree.InOrderTraversal(visit)
 }
 
-func (m *Memtable) InOrderTraversal(visit func(key tree.Comparable, value interface{})) {
+func (m *Memtable) MaxSeq() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.maxSeq
+}
+
+func (m *Memtable) Size() int64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.size
+}
+
+// Age returns how long the oldest unflushed write has been held in the
+// memtable, or zero if it has not been written to.
+func (m *Memtable) Age() time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.oldestWrite.IsZero() {
+		return 0
+	}
+	return time.Since(m.oldestWrite)
+}
+
+// NewestWrite returns the time of the last write to the memtable.
+func (m *Memtable) NewestWrite() time.Time {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.newestWrite
+}
+
+func (m *Memtable) Empty() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.oldestWrite.IsZero()
+}
+
+// RequestFlush hands the memtable to its owner for flushing. It never blocks:
+// if the owner already has a flush queued the request is dropped and retried
+// by the next write.
+func (m *Memtable) RequestFlush() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	m.tree.InOrderTraversal(visit)
+
+	if m.immutable || m.flushRequested {
+		return
+	}
+
+	select {
+	case m.flushChan <- m:
+		m.flushRequested = true
+	default:
+	}
+}
+
+// CancelFlush withdraws a flush request the owner could not carry out, so
+// the next size, age or WAL trigger hands the memtable over again.
+func (m *Memtable) CancelFlush() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.flushRequested = false
+}
+
+// Flushable reports whether the memtable still accepts writes and has no
+// flush pending.
+func (m *Memtable) Flushable() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return !m.immutable && !m.flushRequested
+}
+
+// MarkImmutable freezes the memtable once it has been swapped out for a new
+// one. It stays readable until Release is called after the flush.
+func (m *Memtable) MarkImmutable() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.immutable = true
+}
+
+func (m *Memtable) Release() {
+	m.mutex.RLock()
+	writeBuffer := m.writeBuffer
+	m.mutex.RUnlock()
+
+	if writeBuffer != nil {
+		writeBuffer.Unregister(m)
+	}
 }
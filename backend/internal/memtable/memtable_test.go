@@ -0,0 +1,54 @@
+package memtable
+
+import "testing"
+
+func TestMemtableRequestsFlushWhenFull(t *testing.T) {
+	flushChan := make(chan *Memtable, 1)
+	m := NewMemTable(15, flushChan)
+
+	m.Put(key("k1"), "value", 1)
+	if len(flushChan) != 0 {
+		t.Fatal("flush requested before the memtable is full")
+	}
+	m.Put(key("k2"), "0123456789", 2)
+	if len(flushChan) != 1 || m.Flushable() {
+		t.Fatal("no flush requested for a full memtable")
+	}
+
+	// A request is only made once, until the owner cancels it.
+	<-flushChan
+	m.Put(key("k3"), "value", 3)
+	if len(flushChan) != 0 {
+		t.Fatal("flush requested twice")
+	}
+	m.CancelFlush()
+	m.Put(key("k4"), "value", 4)
+	if len(flushChan) != 1 {
+		t.Fatal("no flush requested again after it was cancelled")
+	}
+}
+
+func TestImmutableMemtableIsNotFlushedAgain(t *testing.T) {
+	flushChan := make(chan *Memtable, 1)
+	m := NewMemTable(1<<20, flushChan)
+	m.Put(key("k"), "v", 1)
+	m.MarkImmutable()
+	m.RequestFlush()
+	if len(flushChan) != 0 {
+		t.Fatal("flush requested for an immutable memtable")
+	}
+}
+
+func TestMemtableKeepsTombstones(t *testing.T) {
+	m := NewMemTable(1<<20, make(chan *Memtable, 1))
+	m.Put(key("k"), "v", 1)
+	m.Delete(key("k"), 2)
+
+	entry, found := m.Get(key("k"))
+	if !found || !entry.Deleted || entry.Seq != 2 {
+		t.Fatalf("got %+v, %v, want a tombstone", entry, found)
+	}
+	if m.MaxSeq() != 2 || m.Empty() {
+		t.Fatalf("max seq %d, empty %v", m.MaxSeq(), m.Empty())
+	}
+}
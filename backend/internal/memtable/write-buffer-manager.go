@@ -0,0 +1,125 @@
+package memtable
+
+import "sync"
+
+// CacheCharger is implemented by caches that can account for memory held
+// outside of them. The write buffer manager charges memtable memory to it so
+// memtables and cached blocks share a single memory budget.
+type CacheCharger interface {
+	Charge(n int64)
+	Release(n int64)
+}
+
+// WriteBufferManager enforces a process-wide memory budget across the active
+// and immutable memtables of every store it is shared with.
+type WriteBufferManager struct {
+	bufferSize int64
+	memoryUsed int64
+	memtables  map[*Memtable]struct{}
+	cache      CacheCharger
+	mutex      sync.Mutex
+}
+
+// NewWriteBufferManager creates a manager with the given budget in bytes. If
+// cache is non-nil, memtable memory is charged to it as well.
+func NewWriteBufferManager(bufferSize int64, cache CacheCharger) *WriteBufferManager {
+	return &WriteBufferManager{
+		bufferSize: bufferSize,
+		memtables:  make(map[*Memtable]struct{}),
+		cache:      cache,
+	}
+}
+
+func (w *WriteBufferManager) BufferSize() int64 {
+	return w.bufferSize
+}
+
+func (w *WriteBufferManager) MemoryUsage() int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.memoryUsed
+}
+
+func (w *WriteBufferManager) ShouldFlush() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.bufferSize > 0 && w.memoryUsed >= w.bufferSize
+}
+
+// Register starts tracking a memtable. Its memory is reported through
+// ReserveMemory as it grows and released by Unregister once it is flushed.
+func (w *WriteBufferManager) Register(m *Memtable) {
+	w.mutex.Lock()
+	w.memtables[m] = struct{}{}
+	w.mutex.Unlock()
+
+	m.mutex.Lock()
+	m.writeBuffer = w
+	m.mutex.Unlock()
+}
+
+func (w *WriteBufferManager) Unregister(m *Memtable) {
+	w.mutex.Lock()
+	if _, ok := w.memtables[m]; !ok {
+		w.mutex.Unlock()
+		return
+	}
+	delete(w.memtables, m)
+	w.mutex.Unlock()
+
+	w.FreeMemory(m.Size())
+}
+
+func (w *WriteBufferManager) ReserveMemory(n int64) {
+	w.mutex.Lock()
+	w.memoryUsed += n
+	overBudget := w.bufferSize > 0 && w.memoryUsed >= w.bufferSize
+	w.mutex.Unlock()
+
+	if w.cache != nil {
+		w.cache.Charge(n)
+	}
+	if overBudget {
+		w.flushLargest()
+	}
+}
+
+func (w *WriteBufferManager) FreeMemory(n int64) {
+	w.mutex.Lock()
+	w.memoryUsed -= n
+	if w.memoryUsed < 0 {
+		w.memoryUsed = 0
+	}
+	w.mutex.Unlock()
+
+	if w.cache != nil {
+		w.cache.Release(n)
+	}
+}
+
+// flushLargest asks the owner of the largest active memtable to flush it.
+// Immutable memtables are already on their way to disk and are skipped.
+func (w *WriteBufferManager) flushLargest() {
+	w.mutex.Lock()
+	candidates := make([]*Memtable, 0, len(w.memtables))
+	for m := range w.memtables {
+		candidates = append(candidates, m)
+	}
+	w.mutex.Unlock()
+
+	var largest *Memtable
+	var largestSize int64
+	for _, m := range candidates {
+		if !m.Flushable() {
+			continue
+		}
+		if size := m.Size(); size > largestSize {
+			largest = m
+			largestSize = size
+		}
+	}
+
+	if largest != nil {
+		largest.RequestFlush()
+	}
+}
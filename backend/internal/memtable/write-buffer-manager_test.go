@@ -0,0 +1,88 @@
+package memtable
+
+import (
+	"testing"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/tree"
+)
+
+type testCharger struct {
+	charged int64
+}
+
+func (c *testCharger) Charge(n int64)  { c.charged += n }
+func (c *testCharger) Release(n int64) { c.charged -= n }
+
+func key(s string) tree.StringComparable {
+	return tree.StringComparable{Value: s}
+}
+
+func TestWriteBufferManagerAccountsMemory(t *testing.T) {
+	charger := &testCharger{}
+	w := NewWriteBufferManager(0, charger)
+	a := NewMemTable(1<<20, make(chan *Memtable, 1))
+	b := NewMemTable(1<<20, make(chan *Memtable, 1))
+	w.Register(a)
+	w.Register(b)
+
+	a.Put(key("k1"), "value", 1)
+	b.Put(key("k2"), "value", 2)
+	if got := w.MemoryUsage(); got != 14 {
+		t.Fatalf("usage %d after two writes, want 14", got)
+	}
+	// An overwrite only accounts for the difference in size.
+	a.Put(key("k1"), "v", 3)
+	if got := w.MemoryUsage(); got != 10 {
+		t.Fatalf("usage %d after a shrinking overwrite, want 10", got)
+	}
+	if charger.charged != 10 {
+		t.Fatalf("charged %d to the cache, want 10", charger.charged)
+	}
+
+	a.Release()
+	if got := w.MemoryUsage(); got != 7 {
+		t.Fatalf("usage %d after releasing a memtable, want 7", got)
+	}
+	// Releasing twice frees nothing more.
+	a.Release()
+	if got := w.MemoryUsage(); got != 7 || charger.charged != 7 {
+		t.Fatalf("usage %d, charged %d after a second release, want 7", got, charger.charged)
+	}
+}
+
+func TestWriteBufferManagerFlushesLargestMemtable(t *testing.T) {
+	w := NewWriteBufferManager(100, nil)
+	smallChan := make(chan *Memtable, 1)
+	largeChan := make(chan *Memtable, 1)
+	immutableChan := make(chan *Memtable, 1)
+	small := NewMemTable(1<<20, smallChan)
+	large := NewMemTable(1<<20, largeChan)
+	immutable := NewMemTable(1<<20, immutableChan)
+	for _, m := range []*Memtable{small, large, immutable} {
+		w.Register(m)
+	}
+
+	// The immutable memtable is the largest but is already being flushed.
+	immutable.Put(key("i"), string(make([]byte, 50)), 1)
+	immutable.MarkImmutable()
+	large.Put(key("l"), string(make([]byte, 30)), 2)
+	if w.ShouldFlush() {
+		t.Fatal("over budget before reaching it")
+	}
+	small.Put(key("s"), string(make([]byte, 20)), 3)
+	if !w.ShouldFlush() {
+		t.Fatalf("usage %d of %d is not over budget", w.MemoryUsage(), w.BufferSize())
+	}
+
+	select {
+	case m := <-largeChan:
+		if m != large {
+			t.Fatal("flush requested for the wrong memtable")
+		}
+	default:
+		t.Fatal("largest memtable was not flushed")
+	}
+	if len(smallChan) != 0 || len(immutableChan) != 0 {
+		t.Fatal("flush requested for a memtable other than the largest")
+	}
+}
@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Priority orders competing requests. Flushes run at high priority so they
+// are not starved by compaction, which would otherwise stall writes.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityHigh
+	numPriorities
+)
+
+// refillPeriod is how often tokens are added to the bucket. At most one
+// period's worth of tokens can accumulate, which bounds bursts.
+const refillPeriod = 100 * time.Millisecond
+
+// Stats reports how much I/O went through the limiter and how long callers
+// spent waiting for it, indexed by Priority.
+type Stats struct {
+	BytesThrough  [numPriorities]int64
+	Requests      [numPriorities]int64
+	ThrottledTime [numPriorities]time.Duration
+	BytesPerSec   int64
+}
+
+// RateLimiter is a token bucket limiting the bytes per second written by
+// flushes and compactions. A rate of zero or less lets every request through.
+//
+// An auto-tuned limiter moves its rate between a minimum and a maximum in
+// proportion to the pending compaction debt reported by the compactors of the
+// stores sharing it, so compaction is held back while it is keeping up and
+// allowed to catch up when it falls behind.
+type RateLimiter struct {
+	bytesPerSec int64
+	available   int64
+	lastRefill  time.Time
+	waiting     [numPriorities]int
+	stats       Stats
+
+	autoTuned   bool
+	minRate     int64
+	maxRate     int64
+	debtCeiling int64
+	debts       map[uint64]int64
+	nextID      uint64
+
+	mutex sync.Mutex
+}
+
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{
+		bytesPerSec: bytesPerSec,
+		lastRefill:  time.Now(),
+	}
+}
+
+// NewAutoTunedRateLimiter returns a limiter running at minBytesPerSec with no
+// compaction debt and at maxBytesPerSec once the debt reaches debtCeiling. A
+// minimum of zero leaves writes unlimited while there is no debt.
+func NewAutoTunedRateLimiter(minBytesPerSec, maxBytesPerSec, debtCeiling int64) *RateLimiter {
+	r := NewRateLimiter(minBytesPerSec)
+	r.autoTuned = true
+	r.minRate = minBytesPerSec
+	r.maxRate = maxBytesPerSec
+	r.debtCeiling = debtCeiling
+	r.debts = make(map[uint64]int64)
+	return r
+}
+
+func (r *RateLimiter) SetBytesPerSecond(bytesPerSec int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.refill()
+	r.bytesPerSec = bytesPerSec
+}
+
+func (r *RateLimiter) BytesPerSecond() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.bytesPerSec
+}
+
+// NewID returns a number unique within the limiter, which a store sharing it
+// passes to SetPendingCompactionBytes to report its own compaction debt.
+func (r *RateLimiter) NewID() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nextID++
+	return r.nextID
+}
+
+// SetPendingCompactionBytes records the amount of data waiting to be compacted
+// in the store with the given ID and adapts the rate of an auto-tuned limiter
+// to the total debt of every store sharing it. It is a no-op otherwise.
+func (r *RateLimiter) SetPendingCompactionBytes(id uint64, debt int64) {
+	if !r.autoTuned {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if debt > 0 {
+		r.debts[id] = debt
+	} else {
+		delete(r.debts, id)
+	}
+	var total int64
+	for _, debt := range r.debts {
+		total += debt
+	}
+
+	ratio := 1.0
+	if r.debtCeiling > 0 && total < r.debtCeiling {
+		ratio = float64(total) / float64(r.debtCeiling)
+	}
+	r.refill()
+	r.bytesPerSec = r.minRate + int64(float64(r.maxRate-r.minRate)*ratio)
+}
+
+// Request blocks until n bytes may be written at the given priority.
+func (r *RateLimiter) Request(n int64, pri Priority) {
+	start := time.Now()
+	for remaining := n; remaining > 0; {
+		r.mutex.Lock()
+		chunk := remaining
+		if r.bytesPerSec > 0 {
+			chunk = min(remaining, r.burst())
+		}
+		r.mutex.Unlock()
+		r.acquire(chunk, pri)
+		remaining -= chunk
+	}
+
+	r.mutex.Lock()
+	r.stats.BytesThrough[pri] += n
+	r.stats.Requests[pri]++
+	r.stats.ThrottledTime[pri] += time.Since(start)
+	r.mutex.Unlock()
+}
+
+func (r *RateLimiter) Stats() Stats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stats := r.stats
+	stats.BytesPerSec = r.bytesPerSec
+	return stats
+}
+
+// burst returns the number of tokens accrued in one refill period. Rates are
+// converted through float64 so that large rates and long idle times cannot
+// overflow. Callers must hold the mutex.
+func (r *RateLimiter) burst() int64 {
+	return max(int64(float64(r.bytesPerSec)*refillPeriod.Seconds()), 1)
+}
+
+// acquire takes n tokens, waiting for refills as needed. Low priority
+// requests only proceed while no high priority request is waiting.
+func (r *RateLimiter) acquire(n int64, pri Priority) {
+	r.mutex.Lock()
+	r.waiting[pri]++
+	for {
+		if r.bytesPerSec <= 0 {
+			r.waiting[pri]--
+			r.mutex.Unlock()
+			return
+		}
+		r.refill()
+		if r.available >= n && (pri == PriorityHigh || r.waiting[PriorityHigh] == 0) {
+			r.available -= n
+			r.waiting[pri]--
+			r.mutex.Unlock()
+			return
+		}
+
+		wait := refillPeriod
+		if deficit := n - r.available; deficit > 0 {
+			wait = min(wait, tokenTime(deficit, r.bytesPerSec))
+		}
+		r.mutex.Unlock()
+		time.Sleep(wait)
+		r.mutex.Lock()
+	}
+}
+
+// refill adds the tokens accrued since the last refill, capped at one
+// period's worth. lastRefill only moves forward by the time that produced
+// whole tokens, so frequent refills do not round tokens away. Callers must
+// hold the mutex.
+func (r *RateLimiter) refill() {
+	now := time.Now()
+	if r.bytesPerSec <= 0 {
+		r.lastRefill = now
+		return
+	}
+
+	burst := r.burst()
+	elapsed := now.Sub(r.lastRefill)
+	if elapsed >= refillPeriod {
+		r.available, r.lastRefill = burst, now
+		return
+	}
+	tokens := int64(float64(r.bytesPerSec) * elapsed.Seconds())
+	if tokens == 0 {
+		return
+	}
+	r.available += tokens
+	r.lastRefill = r.lastRefill.Add(tokenTime(tokens, r.bytesPerSec))
+	if r.available >= burst {
+		r.available, r.lastRefill = burst, now
+	}
+}
+
+// tokenTime returns how long it takes to accrue n tokens at bytesPerSec.
+func tokenTime(n, bytesPerSec int64) time.Duration {
+	return time.Duration(float64(n) / float64(bytesPerSec) * float64(time.Second))
+}
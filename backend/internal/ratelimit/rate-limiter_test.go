@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoTunedRateFollowsTotalDebt(t *testing.T) {
+	r := NewAutoTunedRateLimiter(1000, 11000, 100)
+	a, b := r.NewID(), r.NewID()
+	if a == b {
+		t.Fatalf("stores share ID %d", a)
+	}
+
+	steps := []struct {
+		id   uint64
+		debt int64
+		want int64
+	}{
+		{a, 0, 1000},
+		{a, 30, 4000},
+		// The debt of both stores counts, not only the last one reported.
+		{b, 20, 6000},
+		{a, 0, 3000},
+		{b, 500, 11000},
+		{b, 0, 1000},
+	}
+	for _, step := range steps {
+		r.SetPendingCompactionBytes(step.id, step.debt)
+		if got := r.BytesPerSecond(); got != step.want {
+			t.Fatalf("debt %d for store %d: rate %d, want %d", step.debt, step.id, got, step.want)
+		}
+	}
+}
+
+func TestFixedRateIgnoresDebt(t *testing.T) {
+	r := NewRateLimiter(1000)
+	r.SetPendingCompactionBytes(r.NewID(), 1<<30)
+	if got := r.BytesPerSecond(); got != 1000 {
+		t.Fatalf("rate %d, want 1000", got)
+	}
+}
+
+func TestRequestIsThrottled(t *testing.T) {
+	r := NewRateLimiter(10000)
+	start := time.Now()
+	r.Request(3000, PriorityLow)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("3000 bytes at 10000 bytes per second took %v", elapsed)
+	}
+
+	stats := r.Stats()
+	if stats.BytesThrough[PriorityLow] != 3000 || stats.Requests[PriorityLow] != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestUnlimitedRequestsDoNotWait(t *testing.T) {
+	r := NewRateLimiter(0)
+	start := time.Now()
+	r.Request(1<<30, PriorityHigh)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("unlimited request took %v", elapsed)
+	}
+}
@@ -0,0 +1,18 @@
+package sstable
+
+import "encoding/binary"
+
+// With Options.BlockCache set, data blocks are cached decompressed under the
+// table's cache ID and the block's offset, so repeated reads of a hot block
+// skip the file and the decompressor. The meta blocks a table reader keeps in
+// memory (index, filters and dictionary) are inserted as well and stay pinned
+// while the reader is open, which makes the cache capacity cover them without
+// ever evicting them. Partitions of a partitioned index or filter are cached
+// like data blocks, the index ones decoded.
+
+func (sst *SSTable) blockCacheKey(offset int64) string {
+	var key [16]byte
+	binary.LittleEndian.PutUint64(key[0:], sst.cacheID)
+	binary.LittleEndian.PutUint64(key[8:], uint64(offset))
+	return string(key[:])
+}
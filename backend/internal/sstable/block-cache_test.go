@@ -0,0 +1,77 @@
+package sstable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+)
+
+// writeTable writes entries to a new table in dir and opens it with opts.
+func writeTable(t *testing.T, dir, name string, entries []Entry, opts Options) *SSTable {
+	t.Helper()
+	filename := filepath.Join(dir, name)
+	sst := NewSSTable(filename)
+	sst.opts = opts
+	if err := sst.Write(entries); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenSSTable(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reopened
+}
+
+func TestBlockCache(t *testing.T) {
+	c := cache.NewCache(1<<20, cache.LRU)
+	opts := Options{BlockSize: 1024, BlockCache: c, CompressionPerLevel: []Compressor{NewLZCompressor()}}
+	entries := tableEntries(500)
+	sst := writeTable(t, t.TempDir(), "1.sst", entries, opts)
+
+	checkTable(t, sst, entries)
+	hits := c.Stats().Hits
+	checkTable(t, sst, entries)
+	stats := c.Stats()
+	if stats.Hits-hits < int64(len(entries)) {
+		t.Fatalf("%d cache hits rereading %d keys", stats.Hits-hits, len(entries))
+	}
+	// The table has no table cache, so its reader and the meta blocks it
+	// pinned are gone after every read.
+	if stats.PinnedUsage != 0 {
+		t.Fatalf("%d bytes still pinned", stats.PinnedUsage)
+	}
+}
+
+// Tables sharing a cache keep their blocks apart even at equal offsets.
+func TestBlockCacheSharedByTables(t *testing.T) {
+	c := cache.NewCache(1<<20, cache.LRU)
+	opts := Options{BlockSize: 1024, BlockCache: c}
+	dir := t.TempDir()
+	first := tableEntries(200)
+	second := tableEntries(200)
+	for i := range second {
+		if !second[i].Deleted {
+			second[i].Value = "second"
+		}
+	}
+	a := writeTable(t, dir, "1.sst", first, opts)
+	b := writeTable(t, dir, "2.sst", second, opts)
+
+	for i := 0; i < 2; i++ {
+		checkTable(t, a, first)
+		checkTable(t, b, second)
+	}
+}
+
+func TestBlockCacheEvictsUnderPressure(t *testing.T) {
+	c := cache.NewCache(8<<10, cache.Clock)
+	opts := Options{BlockSize: 1024, BlockCache: c}
+	entries := tableEntries(2000)
+	sst := writeTable(t, t.TempDir(), "1.sst", entries, opts)
+
+	checkTable(t, sst, entries)
+	if stats := c.Stats(); stats.Usage > stats.Capacity || stats.Evictions == 0 {
+		t.Fatalf("stats %+v reading a table larger than the cache", stats)
+	}
+}
@@ -0,0 +1,124 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+)
+
+// Records are grouped into data blocks of about Options.BlockSize bytes,
+// each compressed on its own. The index block lists every data block in key
+// order with the last key it holds, where it is stored and the compressor
+// that wrote it, so a lookup reads and decompresses a single block.
+
+const indexBlockName = "index"
+
+// defaultBlockSize is used when Options.BlockSize is not set, and to split
+// tables written before data blocks into blocks when they are opened.
+const defaultBlockSize = 4096
+
+type blockIndexEntry struct {
+	lastKey     string
+	handle      blockHandle
+	compression byte
+}
+
+func encodeIndexBlock(entries []blockIndexEntry) []byte {
+	var buf []byte
+	for _, entry := range entries {
+		buf = appendIndexEntry(buf, entry)
+	}
+	return buf
+}
+
+func appendIndexEntry(buf []byte, entry blockIndexEntry) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(entry.lastKey)))
+	buf = append(buf, entry.lastKey...)
+	buf = binary.AppendUvarint(buf, uint64(entry.handle.Offset))
+	buf = binary.AppendUvarint(buf, uint64(entry.handle.Size))
+	return append(buf, entry.compression)
+}
+
+func decodeIndexBlock(data []byte) ([]blockIndexEntry, error) {
+	var entries []blockIndexEntry
+	for len(data) > 0 {
+		var entry blockIndexEntry
+
+		keyLength, n := binary.Uvarint(data)
+		if n <= 0 || keyLength > uint64(len(data)-n) {
+			return nil, fmt.Errorf("corrupt index block")
+		}
+		entry.lastKey = string(data[n : n+int(keyLength)])
+		data = data[n+int(keyLength):]
+
+		offset, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("corrupt index block")
+		}
+		data = data[n:]
+		size, n := binary.Uvarint(data)
+		if n <= 0 || n >= len(data) {
+			return nil, fmt.Errorf("corrupt index block")
+		}
+		entry.handle = blockHandle{Offset: int64(offset), Size: int64(size)}
+		entry.compression = data[n]
+		data = data[n+1:]
+
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readDataBlock returns the data block located by entry, decompressed, from
+// the block cache or from the table's file. The returned handle keeps a
+// cached block from being evicted and must be released once the block is no
+// longer used; it is nil without a block cache.
+func (sst *SSTable) readDataBlock(r *tableReader, entry blockIndexEntry) ([]byte, *cache.Handle, error) {
+	c := sst.opts.BlockCache
+	// Uncompressed blocks of a mapped file are served from the mapping,
+	// which the page cache already keeps in memory.
+	if c == nil || (r.mapping != nil && entry.compression == noCompression) {
+		data, err := sst.decodeDataBlock(r, entry)
+		return data, nil, err
+	}
+
+	key := sst.blockCacheKey(entry.handle.Offset)
+	if h := c.Lookup(key); h != nil {
+		return h.Value().([]byte), h, nil
+	}
+	data, err := sst.decodeDataBlock(r, entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, c.Insert(key, data, int64(len(data))), nil
+}
+
+// decodeDataBlock reads and decompresses a data block from the table's file.
+func (sst *SSTable) decodeDataBlock(r *tableReader, entry blockIndexEntry) ([]byte, error) {
+	data, err := r.readBlock(entry.handle)
+	if err != nil {
+		return nil, err
+	}
+	if entry.compression == noCompression {
+		return data, nil
+	}
+
+	compressor, err := compressorByID(entry.compression, sst.opts.CompressionPerLevel)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.dict) > 0 {
+		dictCompressor, ok := compressor.(DictCompressor)
+		if !ok {
+			return nil, fmt.Errorf("compression %s does not support dictionaries", compressor.Name())
+		}
+		data, err = dictCompressor.DecompressWithDict(data, r.dict)
+	} else {
+		data, err = compressor.Decompress(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("block at offset %d: %v", entry.handle.Offset, err)
+	}
+	return data, nil
+}
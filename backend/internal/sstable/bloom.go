@@ -0,0 +1,80 @@
+package sstable
+
+import "math"
+
+// bloomFilterPolicy builds bit-packed bloom filters. Probe positions come from
+// double hashing: the i-th probe of a key with hash h is h1 + i*h2, where h1
+// and h2 are the two halves of h.
+//
+// Encoded, a filter is the bit array followed by one byte holding the number
+// of probes.
+type bloomFilterPolicy struct {
+	fpRate float64
+}
+
+// NewBloomFilterPolicy returns a policy building bloom filters with the given
+// target false positive rate.
+func NewBloomFilterPolicy(fpRate float64) FilterPolicy {
+	return bloomFilterPolicy{fpRate: fpRate}
+}
+
+func (p bloomFilterPolicy) Name() string {
+	return "bloom"
+}
+
+// bloomBitsPerKey is the filter size per key that minimises the false
+// positive rate fpRate, with bloomProbes the matching number of probes.
+func bloomBitsPerKey(fpRate float64) float64 {
+	return -math.Log(fpRate) / (math.Ln2 * math.Ln2)
+}
+
+func bloomProbes(fpRate float64) int {
+	probes := int(math.Round(-math.Log2(fpRate)))
+	if probes < 1 {
+		probes = 1
+	}
+	if probes > 30 {
+		probes = 30
+	}
+	return probes
+}
+
+func (p bloomFilterPolicy) CreateFilter(hashes []uint64) []byte {
+	numBits := int(math.Ceil(float64(len(hashes)) * bloomBitsPerKey(p.fpRate)))
+	if numBits < 64 {
+		numBits = 64
+	}
+	probes := bloomProbes(p.fpRate)
+
+	filter := make([]byte, (numBits+7)/8+1)
+	bits := filter[:len(filter)-1]
+	filter[len(filter)-1] = byte(probes)
+
+	size := uint64(len(bits)) * 8
+	for _, h := range hashes {
+		h1, h2 := h&0xffffffff, h>>32|1
+		for i := uint64(0); i < uint64(probes); i++ {
+			bit := (h1 + i*h2) % size
+			bits[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	return filter
+}
+
+func (p bloomFilterPolicy) MayContain(filter []byte, h uint64) bool {
+	if len(filter) < 2 {
+		return true
+	}
+	bits := filter[:len(filter)-1]
+	probes := uint64(filter[len(filter)-1])
+
+	size := uint64(len(bits)) * 8
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < probes; i++ {
+		bit := (h1 + i*h2) % size
+		if bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package sstable
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func testHashes(prefix string, n int) []uint64 {
+	hashes := make([]uint64, n)
+	for i := range hashes {
+		hashes[i] = keyHash(fmt.Sprintf("%s%06d", prefix, i))
+	}
+	return hashes
+}
+
+// checkFilterPolicy checks that a filter built by policy finds every key it
+// was built from and that keys it was not built from get through at no more
+// than twice the target false positive rate.
+func checkFilterPolicy(t *testing.T, policy FilterPolicy, fpRate float64) {
+	t.Helper()
+	const n = 10000
+	filter := policy.CreateFilter(testHashes("key", n))
+	for i, h := range testHashes("key", n) {
+		if !policy.MayContain(filter, h) {
+			t.Fatalf("key %d is missing from the filter", i)
+		}
+	}
+
+	falsePositives := 0
+	for _, h := range testHashes("missing", n) {
+		if policy.MayContain(filter, h) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 2*fpRate {
+		t.Fatalf("false positive rate %.4f, target %.4f", rate, fpRate)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	for _, fpRate := range []float64{0.1, 0.01, 0.001} {
+		t.Run(fmt.Sprint(fpRate), func(t *testing.T) {
+			checkFilterPolicy(t, NewBloomFilterPolicy(fpRate), fpRate)
+		})
+	}
+}
+
+func TestBloomFilterSize(t *testing.T) {
+	policy := NewBloomFilterPolicy(0.01)
+	filter := policy.CreateFilter(testHashes("key", 1000))
+	// About 9.6 bits per key for a 1% false positive rate.
+	bits := float64(len(filter)-1) * 8
+	if want := 1000 * bloomBitsPerKey(0.01); math.Abs(bits-want) > 16 {
+		t.Fatalf("filter of %.0f bits, want about %.0f", bits, want)
+	}
+	if probes := filter[len(filter)-1]; probes != 7 {
+		t.Fatalf("%d probes, want 7", probes)
+	}
+
+	empty := policy.CreateFilter(nil)
+	if policy.MayContain(empty, keyHash("key")) {
+		t.Fatal("empty filter may contain a key")
+	}
+}
+
+// Filters are stored in the table and read back by the policy that built
+// them, whatever policy is configured when the table is opened.
+func TestTableFilterIsPersisted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "1.sst")
+	sst := NewSSTable(filename)
+	sst.opts = Options{FilterPolicy: NewBloomFilterPolicy(0.01)}
+	entries := tableEntries(1000)
+	if err := sst.Write(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenSSTable(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !reopened.MayContain(entry.Key) {
+			t.Fatalf("filter rules out %s", entry.Key)
+		}
+	}
+	// Keys inside the table's key range, so only the filter can rule them out.
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if reopened.MayContain(fmt.Sprintf("key%06d.missing", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 20 {
+		t.Fatalf("%d of 1000 missing keys pass the filter", falsePositives)
+	}
+}
@@ -0,0 +1,107 @@
+package sstable
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// Compressor compresses data blocks. Its ID is recorded with every block it
+// compressed, so IDs must be unique and never reused for another format.
+// ID 0 is reserved for uncompressed blocks.
+type Compressor interface {
+	ID() byte
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// DictCompressor is a Compressor that can also use a dictionary shared by all
+// blocks of a table, which helps blocks of small, similar values that have
+// too little redundancy on their own.
+type DictCompressor interface {
+	Compressor
+	CompressWithDict(src, dict []byte) ([]byte, error)
+	DecompressWithDict(src, dict []byte) ([]byte, error)
+}
+
+const noCompression byte = 0
+
+// builtinCompressors are used to read blocks written with a compressor that is
+// not configured any more.
+var builtinCompressors = []Compressor{
+	NewFlateCompressor(flate.DefaultCompression),
+	NewLZCompressor(),
+}
+
+// compressorByID finds the compressor that wrote a block, preferring the
+// configured ones over the built-in ones.
+func compressorByID(id byte, configured []Compressor) (Compressor, error) {
+	for _, c := range configured {
+		if c != nil && c.ID() == id {
+			return c, nil
+		}
+	}
+	for _, c := range builtinCompressors {
+		if c.ID() == id {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown compression %d", id)
+}
+
+// compressorName names the compression of a table written with c.
+func compressorName(c Compressor) string {
+	if c == nil {
+		return "none"
+	}
+	return c.Name()
+}
+
+type flateCompressor struct {
+	level int
+}
+
+// NewFlateCompressor compresses blocks with DEFLATE at the given
+// compress/flate level, trading speed for a better ratio than the LZ codec.
+func NewFlateCompressor(level int) Compressor {
+	return flateCompressor{level: level}
+}
+
+func (c flateCompressor) ID() byte {
+	return 1
+}
+
+func (c flateCompressor) Name() string {
+	return "flate"
+}
+
+func (c flateCompressor) Compress(src []byte) ([]byte, error) {
+	return c.CompressWithDict(src, nil)
+}
+
+func (c flateCompressor) Decompress(src []byte) ([]byte, error) {
+	return c.DecompressWithDict(src, nil)
+}
+
+func (c flateCompressor) CompressWithDict(src, dict []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriterDict(&buf, c.level, dict)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c flateCompressor) DecompressWithDict(src, dict []byte) ([]byte, error) {
+	r := flate.NewReaderDict(bytes.NewReader(src), dict)
+	defer r.Close()
+	return io.ReadAll(r)
+}
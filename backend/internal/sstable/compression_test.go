@@ -0,0 +1,193 @@
+package sstable
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func testBlocks() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 4096)
+	rng.Read(random)
+
+	var records bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&records, "tenant%02d/user%05d={\"name\":\"user %d\",\"active\":true}", i%7, i, i)
+	}
+
+	return map[string][]byte{
+		"empty":      {},
+		"one byte":   {'x'},
+		"short":      []byte("abc"),
+		"run":        bytes.Repeat([]byte{'a'}, 10000),
+		"overlapped": bytes.Repeat([]byte("abcd"), 1000),
+		"random":     random,
+		"records":    records.Bytes(),
+	}
+}
+
+func testDict() []byte {
+	var dict bytes.Buffer
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&dict, "tenant%02d/user={\"name\":\"user\",\"active\":true}", i%7)
+	}
+	return dict.Bytes()
+}
+
+func TestCompressorsRoundTrip(t *testing.T) {
+	compressors := []DictCompressor{
+		NewFlateCompressor(flate.DefaultCompression).(DictCompressor),
+		NewLZCompressor().(DictCompressor),
+	}
+	dicts := map[string][]byte{"no dict": nil, "dict": testDict()}
+
+	for _, c := range compressors {
+		for dictName, dict := range dicts {
+			for name, block := range testBlocks() {
+				t.Run(c.Name()+"/"+dictName+"/"+name, func(t *testing.T) {
+					compressed, err := c.CompressWithDict(block, dict)
+					if err != nil {
+						t.Fatalf("compress: %v", err)
+					}
+					got, err := c.DecompressWithDict(compressed, dict)
+					if err != nil {
+						t.Fatalf("decompress: %v", err)
+					}
+					if !bytes.Equal(got, block) {
+						t.Fatalf("round trip changed the block: got %d bytes, want %d", len(got), len(block))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestLZDictionaryImprovesSmallBlocks(t *testing.T) {
+	c := NewLZCompressor().(DictCompressor)
+	block := []byte("tenant03/user00042={\"name\":\"user 42\",\"active\":true}")
+
+	plain, err := c.Compress(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withDict, err := c.CompressWithDict(block, testDict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(withDict) >= len(plain) {
+		t.Fatalf("dictionary did not help: %d bytes with it, %d without", len(withDict), len(plain))
+	}
+}
+
+func TestLZRejectsCorruptBlocks(t *testing.T) {
+	c := NewLZCompressor()
+	valid, err := c.Compress(bytes.Repeat([]byte("abcdefgh"), 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		block []byte
+	}{
+		{"empty", nil},
+		{"size only", valid[:2]},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing bytes", append(append([]byte{}, valid...), 0)},
+		{"size too large", append([]byte{0xff, 0x01}, valid[2:]...)},
+		// One literal "a", then a match reaching back further than the output.
+		{"offset out of range", []byte{10, 1, 'a', 9, 2, 0}},
+		{"zero offset", []byte{10, 1, 'a', 9, 0, 0}},
+		{"literals past end", []byte{10, 20, 'a'}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := c.Decompress(test.block); err == nil {
+				t.Fatal("corrupt block decompressed without error")
+			}
+		})
+	}
+}
+
+func TestFlateRejectsCorruptBlocks(t *testing.T) {
+	c := NewFlateCompressor(flate.DefaultCompression)
+	valid, err := c.Compress(testBlocks()["records"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		block []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)/2]},
+		{"garbage", []byte{0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := c.Decompress(test.block); err == nil {
+				t.Fatal("corrupt block decompressed without error")
+			}
+		})
+	}
+}
+
+// Blocks carry no checksum, so a flipped byte may decode to different data,
+// but it must never crash the reader.
+func TestCompressorsSurviveRandomCorruption(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	dict := testDict()
+	for _, c := range []DictCompressor{
+		NewFlateCompressor(flate.DefaultCompression).(DictCompressor),
+		NewLZCompressor().(DictCompressor),
+	} {
+		valid, err := c.CompressWithDict(testBlocks()["records"], dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2000; i++ {
+			corrupt := append([]byte{}, valid...)
+			for j := 0; j <= rng.Intn(4); j++ {
+				corrupt[rng.Intn(len(corrupt))] = byte(rng.Intn(256))
+			}
+			c.DecompressWithDict(corrupt, dict)
+		}
+	}
+}
+
+func TestCompressorByID(t *testing.T) {
+	custom := NewLZCompressor()
+	tests := []struct {
+		name       string
+		id         byte
+		configured []Compressor
+		want       string
+		wantErr    bool
+	}{
+		{"configured", custom.ID(), []Compressor{nil, custom}, "lz", false},
+		{"builtin flate", 1, nil, "flate", false},
+		{"builtin lz", 2, []Compressor{nil}, "lz", false},
+		{"unknown", 99, nil, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := compressorByID(test.id, test.configured)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Name() != test.want {
+				t.Fatalf("got %s, want %s", c.Name(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Data blocks store keys prefix-compressed: each record keeps only the part
+// of its key that differs from the previous key. Every restart interval
+// records the full key is stored instead, and the offsets of these restart
+// points trail the block, so a lookup binary searches them and decodes at
+// most one interval of records.
+//
+// A record is the varint shared key length, the varint unshared key length,
+// the varint value length, the varint sequence number, the kind byte, the
+// unshared key bytes and the value. The block ends with the restart offsets
+// and their count, each a little-endian uint32.
+
+// formatPrefixCompressed is the FormatVersion of tables whose data blocks
+// use this format, the only one written so far.
+const formatPrefixCompressed = 1
+
+const defaultBlockRestartInterval = 16
+
+type blockBuilder struct {
+	buf             []byte
+	restarts        []uint32
+	restartInterval int
+	counter         int
+	lastKey         string
+}
+
+func newBlockBuilder(restartInterval int) *blockBuilder {
+	if restartInterval <= 0 {
+		restartInterval = defaultBlockRestartInterval
+	}
+	return &blockBuilder{restartInterval: restartInterval}
+}
+
+func (b *blockBuilder) add(entry Entry) {
+	shared := 0
+	if b.counter%b.restartInterval == 0 {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+	} else {
+		for shared < len(b.lastKey) && shared < len(entry.Key) && b.lastKey[shared] == entry.Key[shared] {
+			shared++
+		}
+	}
+
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(entry.Key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(entry.Value)))
+	b.buf = binary.AppendUvarint(b.buf, entry.Seq)
+	b.buf = append(b.buf, entry.kind())
+	b.buf = append(b.buf, entry.Key[shared:]...)
+	b.buf = append(b.buf, entry.Value...)
+
+	b.lastKey = entry.Key
+	b.counter++
+}
+
+func (b *blockBuilder) empty() bool {
+	return b.counter == 0
+}
+
+// size estimates the size of the finished block.
+func (b *blockBuilder) size() int {
+	return len(b.buf) + 4*(len(b.restarts)+1)
+}
+
+// finish returns the encoded block and resets the builder for the next one.
+func (b *blockBuilder) finish() []byte {
+	block := make([]byte, 0, b.size())
+	block = append(block, b.buf...)
+	for _, restart := range b.restarts {
+		block = binary.LittleEndian.AppendUint32(block, restart)
+	}
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(b.restarts)))
+
+	b.buf, b.restarts, b.counter, b.lastKey = b.buf[:0], b.restarts[:0], 0, ""
+	return block
+}
+
+// blockReader decodes the records of a decompressed data block.
+type blockReader struct {
+	data     []byte
+	restarts []byte
+	offset   int
+	key      []byte
+}
+
+func newBlockReader(data []byte) (*blockReader, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("corrupt data block")
+	}
+	count := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	if count == 0 || count > (len(data)-4)/4 {
+		return nil, fmt.Errorf("corrupt data block")
+	}
+	restartsStart := len(data) - 4 - 4*count
+	return &blockReader{
+		data:     data[:restartsStart],
+		restarts: data[restartsStart : len(data)-4],
+	}, nil
+}
+
+func (b *blockReader) restart(i int) int {
+	return int(binary.LittleEndian.Uint32(b.restarts[4*i:]))
+}
+
+// seek moves the reader to the last restart point before key, so that the
+// next records returned include the first one not less than key.
+func (b *blockReader) seek(key string) error {
+	var err error
+	count := len(b.restarts) / 4
+	i := sort.Search(count, func(i int) bool {
+		b.offset, b.key = b.restart(i), b.key[:0]
+		entry, decodeErr := b.next()
+		if decodeErr == io.EOF {
+			// Every restart point starts a record.
+			decodeErr = fmt.Errorf("corrupt restart point %d", i)
+		}
+		if decodeErr != nil {
+			err = decodeErr
+			return true
+		}
+		return entry.Key >= key
+	})
+	if err != nil {
+		return err
+	}
+	if i > 0 {
+		i--
+	}
+	b.offset, b.key = b.restart(i), b.key[:0]
+	return nil
+}
+
+// next returns the next record, or io.EOF at the end of the block.
+func (b *blockReader) next() (Entry, error) {
+	if b.offset >= len(b.data) {
+		return Entry{}, io.EOF
+	}
+
+	var fields [4]uint64
+	data := b.data[b.offset:]
+	for i := range fields {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return Entry{}, fmt.Errorf("corrupt record at block offset %d", b.offset)
+		}
+		fields[i] = v
+		data = data[n:]
+	}
+	shared, unshared, valueLength, seq := fields[0], fields[1], fields[2], fields[3]
+	if shared > uint64(len(b.key)) || len(data) == 0 ||
+		unshared > uint64(len(data)-1) || valueLength > uint64(len(data)-1)-unshared {
+		return Entry{}, fmt.Errorf("corrupt record at block offset %d", b.offset)
+	}
+
+	kind := data[0]
+	data = data[1:]
+	b.key = append(b.key[:shared], data[:unshared]...)
+	entry := Entry{
+		Key:     string(b.key),
+		Value:   string(data[unshared : unshared+valueLength]),
+		Seq:     seq,
+		Deleted: kind == kindDelete,
+	}
+	b.offset = len(b.data) - len(data) + int(unshared+valueLength)
+	return entry, nil
+}
@@ -0,0 +1,225 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func testEntries(n int) []Entry {
+	entries := make([]Entry, n)
+	for i := range entries {
+		entries[i] = Entry{
+			Key:     fmt.Sprintf("tenant%02d/user%05d", i/10, i),
+			Value:   fmt.Sprintf("value %d", i),
+			Seq:     uint64(n - i),
+			Deleted: i%7 == 3,
+		}
+		if entries[i].Deleted {
+			entries[i].Value = ""
+		}
+	}
+	return entries
+}
+
+func buildBlock(entries []Entry, restartInterval int) []byte {
+	b := newBlockBuilder(restartInterval)
+	for _, entry := range entries {
+		b.add(entry)
+	}
+	return b.finish()
+}
+
+func decodeBlock(block []byte) ([]Entry, error) {
+	r, err := newBlockReader(block)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		entry, err := r.next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestDataBlockRoundTrip(t *testing.T) {
+	tests := []struct {
+		name            string
+		entries         []Entry
+		restartInterval int
+	}{
+		{"single record", testEntries(1), 16},
+		{"every record a restart", testEntries(100), 1},
+		{"interval 2", testEntries(100), 2},
+		{"default interval", testEntries(100), 0},
+		{"one restart", testEntries(100), 1000},
+		{"empty key and value", []Entry{{Key: "", Value: "", Seq: 1}, {Key: "a", Seq: 2}}, 16},
+		{"key is prefix of next", []Entry{{Key: "a", Seq: 1}, {Key: "ab", Seq: 2}, {Key: "abc", Seq: 3}}, 16},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeBlock(buildBlock(test.entries, test.restartInterval))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.entries) {
+				t.Fatalf("read %d records, want %d", len(got), len(test.entries))
+			}
+			for i := range got {
+				if got[i] != test.entries[i] {
+					t.Fatalf("record %d: got %+v, want %+v", i, got[i], test.entries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDataBlockBuilderReuse(t *testing.T) {
+	b := newBlockBuilder(4)
+	first := testEntries(10)
+	for _, entry := range first {
+		b.add(entry)
+	}
+	b.finish()
+	if !b.empty() {
+		t.Fatal("builder not empty after finish")
+	}
+
+	second := []Entry{{Key: "z", Value: "1", Seq: 1}}
+	b.add(second[0])
+	got, err := decodeBlock(b.finish())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != second[0] {
+		t.Fatalf("got %+v, want %+v", got, second)
+	}
+}
+
+func TestDataBlockSeek(t *testing.T) {
+	entries := testEntries(100)
+	for _, restartInterval := range []int{1, 3, 16, 1000} {
+		block := buildBlock(entries, restartInterval)
+		tests := []struct {
+			key  string
+			want int // index of the first entry not less than key, len(entries) if none
+		}{
+			{"", 0},
+			{entries[0].Key, 0},
+			{entries[37].Key, 37},
+			{entries[37].Key + "\x00", 38},
+			{entries[99].Key, 99},
+			{"tenant05/", 50},
+			{"zzz", 100},
+		}
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("interval %d/%q", restartInterval, test.key), func(t *testing.T) {
+				r, err := newBlockReader(block)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := r.seek(test.key); err != nil {
+					t.Fatal(err)
+				}
+				for {
+					entry, err := r.next()
+					if err == io.EOF {
+						if test.want != len(entries) {
+							t.Fatalf("no record found, want %s", entries[test.want].Key)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if entry.Key >= test.key {
+						if test.want == len(entries) || entry != entries[test.want] {
+							t.Fatalf("found %+v, want index %d", entry, test.want)
+						}
+						return
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDataBlockRejectsCorruptBlocks(t *testing.T) {
+	valid := buildBlock(testEntries(20), 4)
+	withRestarts := func(records []byte, restarts ...uint32) []byte {
+		block := append([]byte{}, records...)
+		for _, restart := range restarts {
+			block = binary.LittleEndian.AppendUint32(block, restart)
+		}
+		return binary.LittleEndian.AppendUint32(block, uint32(len(restarts)))
+	}
+	record := func(fields ...uint64) []byte {
+		var buf []byte
+		for _, field := range fields {
+			buf = binary.AppendUvarint(buf, field)
+		}
+		return append(buf, kindValue)
+	}
+
+	tests := []struct {
+		name  string
+		block []byte
+	}{
+		{"empty", nil},
+		{"shorter than count", []byte{1, 0}},
+		{"no restarts", []byte{0, 0, 0, 0}},
+		{"restart count too large", binary.LittleEndian.AppendUint32(nil, 1000)},
+		{"truncated", valid[:len(valid)/2]},
+		{"shared without previous key", withRestarts(append(record(3, 1, 0, 1), 'a'), 0)},
+		{"key past end", withRestarts(append(record(0, 10, 0, 1), 'a'), 0)},
+		{"value past end", withRestarts(append(record(0, 1, 10, 1), 'a'), 0)},
+		{"lengths overflow", withRestarts(append(record(0, math.MaxUint64, 2, 1), 'a'), 0)},
+		{"truncated varint", withRestarts([]byte{0x80}, 0)},
+		{"restart past end", withRestarts(append(record(0, 1, 0, 1), 'a'), 0, 1000)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := newBlockReader(test.block)
+			if err != nil {
+				return
+			}
+			if err := r.seek("zzz"); err != nil {
+				return
+			}
+			for {
+				_, err := r.next()
+				if errors.Is(err, io.EOF) {
+					t.Fatal("corrupt block read without error")
+				}
+				if err != nil {
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestDataBlockSurvivesRandomCorruption(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	valid := buildBlock(testEntries(50), 4)
+	for i := 0; i < 5000; i++ {
+		corrupt := append([]byte{}, valid...)
+		for j := 0; j <= rng.Intn(4); j++ {
+			corrupt[rng.Intn(len(corrupt))] = byte(rng.Intn(256))
+		}
+		decodeBlock(corrupt)
+		if r, err := newBlockReader(corrupt); err == nil {
+			r.seek("tenant02/user00025")
+		}
+	}
+}
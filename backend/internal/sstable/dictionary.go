@@ -0,0 +1,133 @@
+package sstable
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"slices"
+)
+
+const compressionDictBlockName = "compression-dictionary"
+
+// Dictionary training follows the idea of zstd's COVER trainer: the samples
+// are cut into segments, each segment is scored by how often its k-byte
+// substrings occur across all samples, and the best segments are copied into
+// the dictionary until it is full. Substrings already covered by a chosen
+// segment no longer count, so the dictionary does not fill up with copies of
+// the same content.
+const (
+	dictKmerLength    = 8
+	dictSegmentLength = 64
+)
+
+// dictKmer reads the k-mer at the start of data; with k = 8 it fits a uint64,
+// which keeps the frequency table cheap.
+func dictKmer(data []byte) uint64 {
+	return binary.LittleEndian.Uint64(data)
+}
+
+// trainDictionary builds a dictionary of at most size bytes from samples,
+// which are the raw data blocks seen so far. It returns nil if the samples
+// are too small to be useful.
+func trainDictionary(samples [][]byte, size int) []byte {
+	frequencies := make(map[uint64]int)
+	var segments []dictSegment
+	for _, sample := range samples {
+		for i := 0; i+dictKmerLength <= len(sample); i++ {
+			frequencies[dictKmer(sample[i:])]++
+		}
+		for start := 0; start+dictKmerLength <= len(sample); start += dictSegmentLength {
+			end := start + dictSegmentLength
+			if end > len(sample) {
+				end = len(sample)
+			}
+			segments = append(segments, dictSegment{data: sample[start:end]})
+		}
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	scratch := make([]uint64, 0, dictSegmentLength)
+	for i := range segments {
+		segments[i].score = segments[i].scoreWith(frequencies, scratch)
+	}
+	queue := dictSegmentQueue(segments)
+	heap.Init(&queue)
+
+	// Segments are scored lazily: a popped segment is rescored against the
+	// substrings still uncovered and only taken if it still beats the next
+	// best, whose stored score can only be too high.
+	var chosen [][]byte
+	total := 0
+	for queue.Len() > 0 && total < size {
+		best := heap.Pop(&queue).(dictSegment)
+		best.score = best.scoreWith(frequencies, scratch)
+		if best.score == 0 {
+			continue
+		}
+		if queue.Len() > 0 && best.score < queue[0].score {
+			heap.Push(&queue, best)
+			continue
+		}
+
+		data := best.data
+		if total+len(data) > size {
+			data = data[:size-total]
+		}
+		chosen = append(chosen, data)
+		total += len(data)
+		for i := 0; i+dictKmerLength <= len(best.data); i++ {
+			delete(frequencies, dictKmer(best.data[i:]))
+		}
+	}
+
+	// Compressors find recent content cheapest to reference, so the best
+	// segments go at the end.
+	dict := make([]byte, 0, total)
+	for i := len(chosen) - 1; i >= 0; i-- {
+		dict = append(dict, chosen[i]...)
+	}
+	return dict
+}
+
+type dictSegment struct {
+	data  []byte
+	score int
+}
+
+// scoreWith sums the frequencies of the distinct substrings of the segment
+// that occur more than once. kmers is scratch space shared between calls.
+func (s dictSegment) scoreWith(frequencies map[uint64]int, kmers []uint64) int {
+	kmers = kmers[:0]
+	for i := 0; i+dictKmerLength <= len(s.data); i++ {
+		kmers = append(kmers, dictKmer(s.data[i:]))
+	}
+	slices.Sort(kmers)
+	score := 0
+	for _, kmer := range slices.Compact(kmers) {
+		if f := frequencies[kmer]; f > 1 {
+			score += f
+		}
+	}
+	return score
+}
+
+type dictSegmentQueue []dictSegment
+
+func (q dictSegmentQueue) Len() int { return len(q) }
+
+func (q dictSegmentQueue) Less(i, j int) bool { return q[i].score > q[j].score }
+
+func (q dictSegmentQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *dictSegmentQueue) Push(x interface{}) {
+	*q = append(*q, x.(dictSegment))
+}
+
+func (q *dictSegmentQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[0 : n-1]
+	return item
+}
@@ -0,0 +1,88 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestTrainDictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 100; i++ {
+		samples = append(samples, []byte(fmt.Sprintf("tenant%02d/user%05d={\"name\":\"user %d\",\"active\":true,\"plan\":\"free\"}", i%7, i, i)))
+	}
+
+	tests := []struct {
+		name    string
+		samples [][]byte
+		size    int
+		wantNil bool
+	}{
+		{"no samples", nil, 1024, true},
+		{"samples shorter than a k-mer", [][]byte{[]byte("abc"), []byte("de")}, 1024, true},
+		{"size smaller than a segment", samples, 10, false},
+		{"size larger than the samples", samples, 1 << 20, false},
+		{"typical", samples, 512, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dict := trainDictionary(test.samples, test.size)
+			if test.wantNil {
+				if dict != nil {
+					t.Fatalf("got a %d byte dictionary, want none", len(dict))
+				}
+				return
+			}
+			if len(dict) == 0 || len(dict) > test.size {
+				t.Fatalf("got a %d byte dictionary, want 1 to %d bytes", len(dict), test.size)
+			}
+		})
+	}
+}
+
+func TestTrainedDictionaryImprovesCompression(t *testing.T) {
+	// Blocks of a few records each; flate does not look for matches in
+	// inputs much smaller than this.
+	var samples [][]byte
+	for i := 0; i < 40; i++ {
+		var block bytes.Buffer
+		for j := i * 8; j < (i+1)*8; j++ {
+			fmt.Fprintf(&block, "tenant%02d/user%05d={\"name\":\"user %d\",\"active\":true,\"plan\":\"free\"}", j%7, j*31, j)
+		}
+		samples = append(samples, block.Bytes())
+	}
+	dict := trainDictionary(samples[:20], 1024)
+
+	for _, c := range []DictCompressor{
+		NewLZCompressor().(DictCompressor),
+		NewFlateCompressor(6).(DictCompressor),
+	} {
+		t.Run(c.Name(), func(t *testing.T) {
+			var plain, withDict int
+			for _, block := range samples[20:] {
+				compressed, err := c.Compress(block)
+				if err != nil {
+					t.Fatal(err)
+				}
+				plain += len(compressed)
+
+				compressed, err = c.CompressWithDict(block, dict)
+				if err != nil {
+					t.Fatal(err)
+				}
+				withDict += len(compressed)
+
+				got, err := c.DecompressWithDict(compressed, dict)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, block) {
+					t.Fatal("round trip with the trained dictionary changed the block")
+				}
+			}
+			if withDict >= plain {
+				t.Fatalf("dictionary did not help: %d bytes with it, %d without", withDict, plain)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package sstable
+
+// Entry is a single versioned record. Deleted entries are tombstones that
+// shadow older versions of the key until compaction reaches the bottom level.
+type Entry struct {
+	Key     string
+	Value   string
+	Seq     uint64
+	Deleted bool
+}
+
+const (
+	kindValue  uint8 = 1
+	kindDelete uint8 = 2
+)
+
+func (e Entry) kind() uint8 {
+	if e.Deleted {
+		return kindDelete
+	}
+	return kindValue
+}
@@ -0,0 +1,64 @@
+package sstable
+
+import "hash/fnv"
+
+// FilterPolicy builds the filter stored in each table and answers lookups
+// against it. Filters are built over 64-bit key hashes, see keyHash.
+//
+// The policy name is recorded with the filter, so tables keep using the
+// policy they were written with after the configured policy changes.
+// Encoded filters must carry their own parameters, such as the number of
+// probes, so that any instance of a policy can read them.
+type FilterPolicy interface {
+	Name() string
+	CreateFilter(hashes []uint64) []byte
+	// MayContain reports whether the key with hash h may have been added to
+	// filter. False means it definitely was not.
+	MayContain(filter []byte, h uint64) bool
+}
+
+// Filters are stored in meta blocks named after the policy that built them.
+// Prefix filters are built over the prefixes of the keys instead of the keys.
+const (
+	filterBlockPrefix       = "filter."
+	prefixFilterBlockPrefix = "prefix-filter."
+)
+
+// builtinFilterPolicies are used to read tables whose policy differs from the
+// configured one.
+var builtinFilterPolicies = []FilterPolicy{
+	NewBloomFilterPolicy(0.01),
+	NewBlockedBloomFilterPolicy(0.01),
+	NewXorFilterPolicy(0.01),
+}
+
+// filterPolicyByName finds the policy that wrote a filter, preferring the
+// configured policy over the built-in ones.
+func filterPolicyByName(name string, configured FilterPolicy) (FilterPolicy, bool) {
+	if configured != nil && configured.Name() == name {
+		return configured, true
+	}
+	for _, policy := range builtinFilterPolicies {
+		if policy.Name() == name {
+			return policy, true
+		}
+	}
+	return nil, false
+}
+
+// keyHash is a 64-bit FNV-1a hash of key with a final mix so that both halves
+// are usable for double hashing.
+func keyHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return mix64(h.Sum64())
+}
+
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
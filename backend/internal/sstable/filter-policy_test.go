@@ -0,0 +1,59 @@
+package sstable
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterPolicies(t *testing.T) {
+	for _, policy := range builtinFilterPolicies {
+		t.Run(policy.Name(), func(t *testing.T) {
+			checkFilterPolicy(t, policy, 0.01)
+
+			// A filter built from duplicate hashes still finds them.
+			hashes := append(testHashes("key", 100), testHashes("key", 100)...)
+			filter := policy.CreateFilter(hashes)
+			for _, h := range hashes {
+				if !policy.MayContain(filter, h) {
+					t.Fatal("key built from a duplicate hash is missing from the filter")
+				}
+			}
+		})
+	}
+}
+
+func TestXorFilterIsSmallerThanBloom(t *testing.T) {
+	hashes := testHashes("key", 10000)
+	bloom := NewBloomFilterPolicy(0.01).CreateFilter(hashes)
+	xor := NewXorFilterPolicy(0.01).CreateFilter(hashes)
+	if len(xor) >= len(bloom) {
+		t.Fatalf("xor filter of %d bytes, bloom filter of %d", len(xor), len(bloom))
+	}
+}
+
+// Tables keep the filter policy they were written with.
+func TestTablesReadWithAnyFilterPolicy(t *testing.T) {
+	entries := tableEntries(500)
+	for _, policy := range builtinFilterPolicies {
+		t.Run(policy.Name(), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "1.sst")
+			sst := NewSSTable(filename)
+			sst.opts = Options{FilterPolicy: policy}
+			if err := sst.Write(entries); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, configured := range builtinFilterPolicies {
+				reopened, err := OpenSSTable(filename, Options{FilterPolicy: configured})
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkTable(t, reopened, entries)
+				if reopened.MayContain("key000001.missing") && reopened.MayContain("key000002.missing") &&
+					reopened.MayContain("key000003.missing") {
+					t.Fatalf("read with %s, the filter rules out no missing key", configured.Name())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// An SSTable file holds the data records, followed by named meta blocks, a
+// meta index locating them and a fixed-size footer:
+//
+//	[records][meta block]...[meta index][footer]
+//
+// The footer stores the offset and size of the meta index and a magic number.
+
+const tableMagic uint64 = 0x6c736d7373743031 // "lsmsst01"
+
+const footerSize = 8 + 8 + 8
+
+const propertiesBlockName = "properties"
+
+// blockHandle locates a block within the file.
+type blockHandle struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+func encodeFooter(metaIndex blockHandle) []byte {
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer[0:], uint64(metaIndex.Offset))
+	binary.LittleEndian.PutUint64(footer[8:], uint64(metaIndex.Size))
+	binary.LittleEndian.PutUint64(footer[16:], tableMagic)
+	return footer
+}
+
+// readFooter returns the meta index handle of a file of the given size.
+func readFooter(file *os.File, fileSize int64) (blockHandle, error) {
+	if fileSize < footerSize {
+		return blockHandle{}, fmt.Errorf("file too short for a footer")
+	}
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, fileSize-footerSize); err != nil {
+		return blockHandle{}, err
+	}
+	if binary.LittleEndian.Uint64(footer[16:]) != tableMagic {
+		return blockHandle{}, fmt.Errorf("bad magic number")
+	}
+
+	handle := blockHandle{
+		Offset: int64(binary.LittleEndian.Uint64(footer[0:])),
+		Size:   int64(binary.LittleEndian.Uint64(footer[8:])),
+	}
+	if handle.Offset < 0 || handle.Size < 0 || handle.Offset+handle.Size > fileSize-footerSize {
+		return blockHandle{}, fmt.Errorf("meta index out of bounds")
+	}
+	return handle, nil
+}
+
+// readBlock reads the block located by handle from a file of the given size.
+func readBlock(file io.ReaderAt, fileSize int64, handle blockHandle) ([]byte, error) {
+	if handle.Offset < 0 || handle.Size < 0 || handle.Offset > fileSize || handle.Size > fileSize-handle.Offset {
+		return nil, fmt.Errorf("block at offset %d out of bounds", handle.Offset)
+	}
+	block := make([]byte, handle.Size)
+	n, err := file.ReadAt(block, handle.Offset)
+	if int64(n) != handle.Size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("block at offset %d: %v", handle.Offset, err)
+	}
+	return block, nil
+}
+
+// readMetaIndex reads the meta index and returns the handles of the meta
+// blocks by name.
+func readMetaIndex(file *os.File, fileSize int64, handle blockHandle) (map[string]blockHandle, error) {
+	block, err := readBlock(file, fileSize, handle)
+	if err != nil {
+		return nil, err
+	}
+	var metaIndex map[string]blockHandle
+	if err := json.Unmarshal(block, &metaIndex); err != nil {
+		return nil, fmt.Errorf("corrupt meta index: %v", err)
+	}
+	return metaIndex, nil
+}
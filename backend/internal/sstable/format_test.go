@@ -0,0 +1,92 @@
+package sstable
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBlock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "1.sst")
+	data := bytes.Repeat([]byte{1, 2, 3, 4}, 25)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name     string
+		fileSize int64
+		handle   blockHandle
+		wantErr  bool
+	}{
+		{"whole file", 100, blockHandle{Offset: 0, Size: 100}, false},
+		{"last byte", 100, blockHandle{Offset: 99, Size: 1}, false},
+		{"empty block at end", 100, blockHandle{Offset: 100, Size: 0}, false},
+		{"past end", 100, blockHandle{Offset: 90, Size: 20}, true},
+		{"offset past end", 100, blockHandle{Offset: 101, Size: 0}, true},
+		{"negative offset", 100, blockHandle{Offset: -1, Size: 1}, true},
+		{"negative size", 100, blockHandle{Offset: 0, Size: -1}, true},
+		{"size overflows", 100, blockHandle{Offset: 50, Size: 1<<63 - 1}, true},
+		// The file is shorter than the size it was opened with.
+		{"truncated file", 200, blockHandle{Offset: 80, Size: 40}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block, err := readBlock(file, test.fileSize, test.handle)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := data[test.handle.Offset : test.handle.Offset+test.handle.Size]
+			if !bytes.Equal(block, want) {
+				t.Fatalf("got %v, want %v", block, want)
+			}
+		})
+	}
+}
+
+func TestOpenSSTableRejectsDamagedFiles(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "1.sst")
+	sst := NewSSTable(valid)
+	sst.opts = Options{FilterPolicy: NewBloomFilterPolicy(0.01)}
+	if err := sst.Write(tableEntries(100)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"no footer", data[:len(data)-footerSize]},
+		{"truncated", data[len(data)/2:]},
+		{"bad magic", append(append([]byte{}, data[:len(data)-1]...), 0)},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(dir, string(rune('a'+i))+".sst")
+			if err := os.WriteFile(filename, test.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := OpenSSTable(filename, Options{}); err == nil {
+				t.Fatal("damaged table opened without error")
+			}
+		})
+	}
+}
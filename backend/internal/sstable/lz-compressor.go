@@ -0,0 +1,158 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// lzCompressor is a fast LZ77 codec in the spirit of Snappy and LZ4. It finds
+// matches of at least four bytes through a hash table of recent positions
+// and never searches further, so it is much faster than flate at a worse
+// ratio.
+//
+// A compressed block is the varint uncompressed length followed by
+// sequences of a varint literal length, the literals, a varint match length
+// and, if the match length is not zero, a varint match offset. The last
+// sequence has a match length of zero. With a dictionary, the dictionary acts
+// as if it preceded the block, so matches may reach back into it.
+type lzCompressor struct{}
+
+const (
+	lzMinMatch  = 4
+	lzHashBits  = 14
+	lzMaxOffset = 1 << 16
+)
+
+var errCorruptLZ = errors.New("corrupt lz block")
+
+func NewLZCompressor() Compressor {
+	return lzCompressor{}
+}
+
+func (c lzCompressor) ID() byte {
+	return 2
+}
+
+func (c lzCompressor) Name() string {
+	return "lz"
+}
+
+func lzHash(v uint32) uint32 {
+	return v * 2654435761 >> (32 - lzHashBits)
+}
+
+func (c lzCompressor) Compress(src []byte) ([]byte, error) {
+	return c.CompressWithDict(src, nil)
+}
+
+func (c lzCompressor) Decompress(src []byte) ([]byte, error) {
+	return c.DecompressWithDict(src, nil)
+}
+
+func (c lzCompressor) CompressWithDict(block, dict []byte) ([]byte, error) {
+	// Only the end of the dictionary is within reach of the block.
+	if len(dict) > lzMaxOffset {
+		dict = dict[len(dict)-lzMaxOffset:]
+	}
+	src := append(append(make([]byte, 0, len(dict)+len(block)), dict...), block...)
+	dst := binary.AppendUvarint(make([]byte, 0, len(block)/2+16), uint64(len(block)))
+
+	var table [1 << lzHashBits]int32
+	for i := range table {
+		table[i] = -1
+	}
+	for i := 0; i+lzMinMatch <= len(dict); i++ {
+		table[lzHash(binary.LittleEndian.Uint32(src[i:]))] = int32(i)
+	}
+
+	anchor := len(dict)
+	for i := len(dict); i+lzMinMatch <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := lzHash(v)
+		candidate := int(table[h])
+		table[h] = int32(i)
+
+		if candidate < 0 || i-candidate >= lzMaxOffset || binary.LittleEndian.Uint32(src[candidate:]) != v {
+			i++
+			continue
+		}
+
+		length := lzMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		dst = binary.AppendUvarint(dst, uint64(i-anchor))
+		dst = append(dst, src[anchor:i]...)
+		dst = binary.AppendUvarint(dst, uint64(length))
+		dst = binary.AppendUvarint(dst, uint64(i-candidate))
+
+		// Positions inside the match are indexed too, so later matches
+		// prefer recent content over stale dictionary positions.
+		end := i + length
+		for i++; i < end && i+lzMinMatch <= len(src); i++ {
+			table[lzHash(binary.LittleEndian.Uint32(src[i:]))] = int32(i)
+		}
+		i = end
+		anchor = i
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(src)-anchor))
+	dst = append(dst, src[anchor:]...)
+	dst = binary.AppendUvarint(dst, 0)
+	return dst, nil
+}
+
+func (c lzCompressor) DecompressWithDict(src, dict []byte) ([]byte, error) {
+	if len(dict) > lzMaxOffset {
+		dict = dict[len(dict)-lzMaxOffset:]
+	}
+	blockSize, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errCorruptLZ
+	}
+	src = src[n:]
+	size := uint64(len(dict)) + blockSize
+	// The stored size is not trusted for the allocation, in case the block is
+	// corrupt; the output can grow past the estimate through append.
+	capacity := size
+	if limit := uint64(len(dict)+len(src))*8 + 64; capacity > limit {
+		capacity = limit
+	}
+	dst := append(make([]byte, 0, capacity), dict...)
+
+	for {
+		literals, n := binary.Uvarint(src)
+		if n <= 0 || literals > uint64(len(src)-n) || uint64(len(dst))+literals > size {
+			return nil, errCorruptLZ
+		}
+		src = src[n:]
+		dst = append(dst, src[:literals]...)
+		src = src[literals:]
+
+		length, n := binary.Uvarint(src)
+		if n <= 0 {
+			return nil, errCorruptLZ
+		}
+		src = src[n:]
+		if length == 0 {
+			break
+		}
+
+		offset, n := binary.Uvarint(src)
+		if n <= 0 || offset == 0 || offset > uint64(len(dst)) || uint64(len(dst))+length > size {
+			return nil, errCorruptLZ
+		}
+		src = src[n:]
+		// Copy byte by byte, as a match may overlap the bytes it produces.
+		start := len(dst) - int(offset)
+		for i := 0; i < int(length); i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if uint64(len(dst)) != size || len(src) != 0 {
+		return nil, errCorruptLZ
+	}
+	return dst[len(dict):], nil
+}
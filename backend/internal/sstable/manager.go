@@ -2,53 +2,402 @@ package sstable
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/ratelimit"
 )
 
+// SSTableManager owns the live tables of a store, organised in levels. Level
+// 0 holds flushed tables whose key ranges may overlap, ordered oldest first;
+// every deeper level holds tables with disjoint key ranges sorted by key.
 type SSTableManager struct {
-	tables []*SSTable
-	mutex  sync.RWMutex
+	dir              string
+	levels           [][]*SSTable
+	nextFileNumber   int
+	lastSequence     uint64
+	manifest         *manifest
+	opts             Options
+	tableCache       *tableCache
+	rowCacheID       uint64
+	rowInvalidations rowInvalidations
+	rateLimiter      *ratelimit.RateLimiter
+	mutex            sync.RWMutex
 }
 
-func NewSSTableManager() *SSTableManager {
-	return &SSTableManager{
-		tables: make([]*SSTable, 0),
+func NewSSTableManager(dir string, opts Options) *SSTableManager {
+	m := &SSTableManager{
+		dir:        dir,
+		opts:       opts,
+		tableCache: newTableCache(opts.MaxOpenFiles),
+		levels:     make([][]*SSTable, 1),
+	}
+	if opts.RowCache != nil {
+		m.rowCacheID = opts.RowCache.NewID()
+	}
+	return m
+}
+
+// Load replays the manifest left by a previous process and opens every table
+// it lists, so that data whose WAL segments were released stays readable.
+func (m *SSTableManager) Load() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	manifest, edits, err := openManifest(filepath.Join(m.dir, manifestFileName))
+	if err != nil {
+		return err
+	}
+	m.manifest = manifest
+
+	live := make(map[int]int)
+	for _, edit := range edits {
+		for _, meta := range edit.Deleted {
+			delete(live, meta.Number)
+		}
+		for _, meta := range edit.Added {
+			live[meta.Number] = meta.Level
+		}
+		m.nextFileNumber = edit.NextFileNumber
+		m.lastSequence = edit.LastSequence
+	}
+
+	for number, level := range live {
+		sst, err := OpenSSTable(m.tablePath(number), m.opts)
+		if err != nil {
+			return fmt.Errorf("failed to open sstable %d: %v", number, err)
+		}
+		sst.number = number
+		sst.tableCache = m.tableCache
+		m.addTable(level, sst)
+	}
+	for level := range m.levels {
+		m.sortLevel(level)
 	}
+	return nil
+}
+
+// SetRateLimiter throttles table writes. Flushes made through CreateSSTable
+// run at high priority; compactions request their own priority through
+// RateLimiter. It must be called before any table is written.
+func (m *SSTableManager) SetRateLimiter(limiter *ratelimit.RateLimiter) {
+	m.rateLimiter = limiter
 }
 
-func (m *SSTableManager) CreateSSTable(data map[string]string) error {
+func (m *SSTableManager) RateLimiter() *ratelimit.RateLimiter {
+	return m.rateLimiter
+}
+
+func (m *SSTableManager) Dir() string {
+	return m.dir
+}
+
+func (m *SSTableManager) tablePath(number int) string {
+	return filepath.Join(m.dir, fmt.Sprintf("sstable_%d.db", number))
+}
+
+// NewTable allocates a file number and returns an empty table for it, to be
+// written for level. The table becomes visible to reads only once it is
+// installed.
+func (m *SSTableManager) NewTable(level int) *SSTable {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	filename := fmt.Sprintf("sstable_%d.db", len(m.tables))
-	sst := NewSSTable(filename)
-	err := sst.Write(data)
+	number := m.nextFileNumber
+	m.nextFileNumber++
+
+	sst := NewSSTable(m.tablePath(number))
+	sst.number = number
+	sst.level = level
+	sst.opts = m.opts
+	sst.tableCache = m.tableCache
+	return sst
+}
+
+// CreateSSTable writes a flushed memtable to a new level 0 table. lastSeq is
+// the highest sequence number the memtable contained and newestWrite the time
+// of its last write.
+func (m *SSTableManager) CreateSSTable(entries []Entry, lastSeq uint64, newestWrite time.Time) error {
+	sst := m.NewTable(0)
+	writer, err := sst.NewWriter()
 	if err != nil {
 		return err
 	}
+	writer.SetRateLimiter(m.rateLimiter, ratelimit.PriorityHigh)
+	writer.SetNewestEntryTime(newestWrite)
+	for _, entry := range entries {
+		if err := writer.Add(entry); err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+	if err := writer.Finish(); err != nil {
+		os.Remove(sst.filename)
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if lastSeq > m.lastSequence {
+		m.lastSequence = lastSeq
+	}
+	edit := VersionEdit{Added: []FileMeta{{Level: 0, Number: sst.number}}}
+	if err := m.logEdit(edit); err != nil {
+		os.Remove(sst.filename)
+		return err
+	}
+
+	m.addTable(0, sst)
+	m.sortLevel(0)
+	return nil
+}
+
+// InstallCompaction atomically replaces inputs with outputs placed in
+// outputLevel, records the change in the manifest and deletes the inputs.
+func (m *SSTableManager) InstallCompaction(inputs []*SSTable, outputs []*SSTable, outputLevel int) error {
+	m.mutex.Lock()
+
+	var edit VersionEdit
+	for _, sst := range inputs {
+		edit.Deleted = append(edit.Deleted, FileMeta{Level: sst.level, Number: sst.number})
+	}
+	for _, sst := range outputs {
+		edit.Added = append(edit.Added, FileMeta{Level: outputLevel, Number: sst.number})
+	}
+	if err := m.logEdit(edit); err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+
+	for _, sst := range inputs {
+		m.removeTable(sst)
+	}
+	for _, sst := range outputs {
+		m.addTable(outputLevel, sst)
+	}
+	m.sortLevel(outputLevel)
+	m.mutex.Unlock()
+
+	for _, sst := range inputs {
+		if err := sst.Remove(); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveTables moves tables to level without rewriting them, recording only a
+// manifest edit. The caller must make sure they overlap nothing in level.
+func (m *SSTableManager) MoveTables(tables []*SSTable, level int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var edit VersionEdit
+	for _, sst := range tables {
+		edit.Deleted = append(edit.Deleted, FileMeta{Level: sst.level, Number: sst.number})
+		edit.Added = append(edit.Added, FileMeta{Level: level, Number: sst.number})
+	}
+	if err := m.logEdit(edit); err != nil {
+		return err
+	}
 
-	m.tables = append(m.tables, sst)
+	for _, sst := range tables {
+		m.removeTable(sst)
+		m.addTable(level, sst)
+	}
+	m.sortLevel(level)
 	return nil
 }
 
+// logEdit stamps the edit with the current counters and appends it to the
+// manifest. Callers must hold the mutex.
+func (m *SSTableManager) logEdit(edit VersionEdit) error {
+	if m.manifest == nil {
+		return fmt.Errorf("sstable manager is not loaded")
+	}
+	edit.NextFileNumber = m.nextFileNumber
+	edit.LastSequence = m.lastSequence
+	return m.manifest.append(edit)
+}
+
+func (m *SSTableManager) addTable(level int, sst *SSTable) {
+	for len(m.levels) <= level {
+		m.levels = append(m.levels, nil)
+	}
+	sst.level = level
+	m.levels[level] = append(m.levels[level], sst)
+}
+
+func (m *SSTableManager) removeTable(sst *SSTable) {
+	tables := m.levels[sst.level]
+	for i, t := range tables {
+		if t == sst {
+			m.levels[sst.level] = append(tables[:i:i], tables[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *SSTableManager) sortLevel(level int) {
+	tables := m.levels[level]
+	if level == 0 {
+		sort.Slice(tables, func(i, j int) bool { return tables[i].props.MaxSeq < tables[j].props.MaxSeq })
+		return
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].props.SmallestKey < tables[j].props.SmallestKey })
+}
+
+func (m *SSTableManager) LastSequence() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.lastSequence
+}
+
+// Levels returns a snapshot of the tables in every level.
+func (m *SSTableManager) Levels() [][]*SSTable {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	levels := make([][]*SSTable, len(m.levels))
+	for i, tables := range m.levels {
+		levels[i] = make([]*SSTable, len(tables))
+		copy(levels[i], tables)
+	}
+	return levels
+}
+
+// TableInfo describes a live table for reporting.
+type TableInfo struct {
+	Level      int        `json:"level"`
+	Number     int        `json:"number"`
+	FileSize   int64      `json:"file_size"`
+	Properties Properties `json:"properties"`
+}
+
+// TableProperties returns the properties of every live table, level by level.
+func (m *SSTableManager) TableProperties() []TableInfo {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var infos []TableInfo
+	for level, tables := range m.levels {
+		for _, sst := range tables {
+			infos = append(infos, TableInfo{
+				Level:      level,
+				Number:     sst.number,
+				FileSize:   sst.size,
+				Properties: sst.props,
+			})
+		}
+	}
+	return infos
+}
+
 func (m *SSTableManager) GetSSTables() []*SSTable {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	tablesCopy := make([]*SSTable, len(m.tables))
-	copy(tablesCopy, m.tables)
+	var tablesCopy []*SSTable
+	for _, tables := range m.levels {
+		tablesCopy = append(tablesCopy, tables...)
+	}
 	return tablesCopy
 }
 
-func (m *SSTableManager) Read(key string) (string, bool) {
+// NewScanners opens a scanner over [start, end) on every table whose key
+// range and range filter allow keys in that range. With a non-empty prefix,
+// tables whose prefix filter rules it out are skipped as well. Tables are
+// opened under the read lock, so none of them can be deleted by a compaction
+// before it is open. If a table cannot be opened, the scanners opened so far
+// are closed and the error is returned.
+func (m *SSTableManager) NewScanners(start, end, prefix string) ([]*Scanner, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var scanners []*Scanner
+	for _, tables := range m.levels {
+		for _, sst := range tables {
+			if !sst.MayContainRange(start, end) {
+				continue
+			}
+			if prefix != "" && !sst.MayContainPrefix(prefix) {
+				continue
+			}
+			scanner, err := sst.NewRangeScanner(start, end)
+			if err != nil {
+				for _, scanner := range scanners {
+					scanner.Close()
+				}
+				return nil, err
+			}
+			scanners = append(scanners, scanner)
+		}
+	}
+	return scanners, nil
+}
+
+// Read returns the newest value of key in the tables, for a caller that has
+// checked its memtables up to sequence number readSeq. A table that cannot be
+// read fails the lookup rather than letting an older version through.
+func (m *SSTableManager) Read(key string, readSeq uint64) (string, bool, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	for i := len(m.tables) - 1; i >= 0; i-- {
-		if value, found := m.tables[i].Read(key); found {
-			return value, true
+	entry, found, err := m.getCached(key, readSeq)
+	if err != nil || !found || entry.Deleted {
+		return "", false, err
+	}
+	return entry.Value, true, nil
+}
+
+// get returns the newest version of key, which may be a tombstone, and the
+// table holding it. Callers must hold the mutex.
+func (m *SSTableManager) get(key string) (Entry, *SSTable, bool, error) {
+	// Tiered compaction can merge level 0 tables that were not flushed one
+	// after another, so the newest version is found by sequence number rather
+	// than by table order.
+	var newest Entry
+	var newestTable *SSTable
+	for _, sst := range m.levels[0] {
+		entry, found, err := sst.Read(key)
+		if err != nil {
+			return Entry{}, nil, false, err
+		}
+		if found && (newestTable == nil || entry.Seq > newest.Seq) {
+			newest = entry
+			newestTable = sst
+		}
+	}
+	if newestTable != nil {
+		return newest, newestTable, true, nil
+	}
+
+	for _, tables := range m.levels[1:] {
+		i := sort.Search(len(tables), func(i int) bool { return tables[i].props.LargestKey >= key })
+		if i < len(tables) && tables[i].props.SmallestKey <= key {
+			entry, found, err := tables[i].Read(key)
+			if err != nil {
+				return Entry{}, nil, false, err
+			}
+			if found {
+				return entry, tables[i], true, nil
+			}
 		}
 	}
+	return Entry{}, nil, false, nil
+}
 
-	return "", false
+func (m *SSTableManager) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.manifest == nil {
+		return nil
+	}
+	m.tableCache.close()
+	return m.manifest.close()
 }
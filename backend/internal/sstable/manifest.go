@@ -0,0 +1,74 @@
+package sstable
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const manifestFileName = "MANIFEST"
+
+// FileMeta identifies a table and the level it lives in.
+type FileMeta struct {
+	Level  int `json:"level"`
+	Number int `json:"number"`
+}
+
+// VersionEdit is one record of the manifest. Replaying every edit in order
+// yields the current set of live tables per level.
+type VersionEdit struct {
+	Added          []FileMeta `json:"added,omitempty"`
+	Deleted        []FileMeta `json:"deleted,omitempty"`
+	NextFileNumber int        `json:"next_file_number"`
+	LastSequence   uint64     `json:"last_sequence"`
+}
+
+// manifest is an append-only log of version edits, one JSON object per line.
+type manifest struct {
+	file *os.File
+}
+
+func openManifest(path string) (*manifest, []VersionEdit, error) {
+	var edits []VersionEdit
+
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var edit VersionEdit
+			if err := json.Unmarshal(scanner.Bytes(), &edit); err != nil {
+				// A torn final record from a crash mid-append is ignored.
+				break
+			}
+			edits = append(edits, edit)
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, nil, fmt.Errorf("failed to read manifest: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to open manifest: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open manifest: %v", err)
+	}
+	return &manifest{file: file}, edits, nil
+}
+
+func (m *manifest) append(edit VersionEdit) error {
+	data, err := json.Marshal(edit)
+	if err != nil {
+		return err
+	}
+	if _, err := m.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return m.file.Sync()
+}
+
+func (m *manifest) close() error {
+	return m.file.Close()
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd
+
+package sstable
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile fails on platforms without mmap, where tables are read through
+// the file instead.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func munmap(mapping []byte) error {
+	return nil
+}
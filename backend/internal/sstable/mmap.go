@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package sstable
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps size bytes of file read-only into memory.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
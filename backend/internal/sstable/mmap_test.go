@@ -0,0 +1,78 @@
+package sstable
+
+import (
+	"testing"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+)
+
+func TestMmapReads(t *testing.T) {
+	tests := []struct {
+		name       string
+		compressor Compressor
+	}{
+		{"uncompressed", nil},
+		{"lz", NewLZCompressor()},
+	}
+	entries := tableEntries(500)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := cache.NewCache(1<<20, cache.LRU)
+			opts := Options{
+				BlockSize:           1024,
+				BlockCache:          c,
+				CompressionPerLevel: []Compressor{test.compressor},
+				FilterPolicy:        NewBloomFilterPolicy(0.01),
+				UseMmapReads:        true,
+			}
+			sst := writeTable(t, t.TempDir(), "1.sst", entries, opts)
+			sst.tableCache = newTableCache(0)
+			defer sst.tableCache.close()
+
+			r, err := sst.tableCache.acquire(sst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mapped := r.mapping != nil
+			sst.tableCache.release(sst, r)
+			if !mapped {
+				t.Skip("mmap is not supported on this platform")
+			}
+
+			inserts := c.Stats().Inserts
+			checkTable(t, sst, entries)
+			checkTable(t, sst, entries)
+			// Blocks stored uncompressed are sliced out of the mapping rather
+			// than cached; only decompressed blocks go into the cache.
+			cachedBlocks := c.Stats().Inserts - inserts
+			if test.compressor == nil && cachedBlocks != 0 {
+				t.Fatalf("%d blocks of a mapped uncompressed table cached", cachedBlocks)
+			}
+			if test.compressor != nil && cachedBlocks == 0 {
+				t.Fatal("decompressed blocks of a mapped table not cached")
+			}
+		})
+	}
+}
+
+func TestMmapReaderRejectsOutOfBoundsBlocks(t *testing.T) {
+	sst := writeTable(t, t.TempDir(), "1.sst", tableEntries(10), Options{UseMmapReads: true})
+	r, err := openTableReader(sst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close(sst)
+	if r.mapping == nil {
+		t.Skip("mmap is not supported on this platform")
+	}
+
+	for _, handle := range []blockHandle{
+		{Offset: sst.Size() - 4, Size: 8},
+		{Offset: -1, Size: 4},
+		{Offset: 0, Size: -1},
+	} {
+		if _, err := r.readBlock(handle); err == nil {
+			t.Fatalf("read block %+v of a %d byte table", handle, sst.Size())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package sstable
+
+import (
+	"compress/flate"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+)
+
+// Options configure how tables are written.
+type Options struct {
+	// BlockSize is the uncompressed size at which a data block is cut.
+	// Larger blocks compress better; smaller blocks make point lookups read
+	// less.
+	BlockSize int
+
+	// BlockRestartInterval is the number of records between restart points
+	// in a data block. Records in between store only the part of their key
+	// that differs from the previous key, so longer intervals save space
+	// while lookups decode more records.
+	BlockRestartInterval int
+
+	// CompressionPerLevel is the compressor used for tables written to each
+	// level, with the last entry applying to all deeper levels. A nil entry
+	// or an empty list stores blocks uncompressed. Blocks that do not shrink
+	// by at least an eighth are stored uncompressed either way.
+	CompressionPerLevel []Compressor
+
+	// CompressionDictSize enables dictionary compression for tables whose
+	// compressor implements DictCompressor. The writer holds back the first
+	// CompressionDictTrainingBytes of data blocks, trains a dictionary of up
+	// to CompressionDictSize bytes on them and compresses every block of the
+	// table with it. Zero disables dictionaries; a zero training size
+	// samples a hundred times the dictionary size.
+	CompressionDictSize          int
+	CompressionDictTrainingBytes int
+
+	// BlockCache, if set, caches decompressed data blocks and accounts for
+	// the index, filter and dictionary blocks of open tables. The cache may
+	// be shared by any number of stores; DefaultOptions gives every store the
+	// same 8 MB cache.
+	BlockCache *cache.Cache
+
+	// RowCache, if set, caches the newest version of keys read from the
+	// tables, so lookups of hot keys that miss the memtable skip the tables
+	// altogether. Like BlockCache it may be shared by any number of stores.
+	RowCache *cache.Cache
+
+	// MetadataBlockSize, when set, partitions the index and key filter of
+	// every table into blocks of about this size, found through a small
+	// top-level index. Open tables only keep the top-level blocks in memory
+	// and read partitions through the block cache as they are needed, which
+	// suits tables too large for their whole index and filter to stay
+	// resident. Zero writes a single index and filter block per table.
+	MetadataBlockSize int
+
+	// MaxOpenFiles bounds the number of tables whose file and parsed index
+	// and filters are kept open between reads; the least recently used
+	// table is closed when another one is opened. Zero keeps every table
+	// open.
+	MaxOpenFiles int
+
+	// UseMmapReads maps table files into memory and serves blocks from the
+	// mapping, without copying uncompressed ones. It suits read-mostly data
+	// that fits in the page cache.
+	UseMmapReads bool
+
+	// FilterPolicy builds the filter stored in every table, which lets
+	// lookups skip tables that cannot hold a key. Nil disables filters.
+	FilterPolicy FilterPolicy
+
+	// PrefixExtractor, together with FilterPolicy, adds a filter over key
+	// prefixes to every table, so prefix scans can skip tables that hold no
+	// key with the prefix.
+	PrefixExtractor PrefixExtractor
+
+	// RangeFilterMaxPrefixLength enables a range filter in every table,
+	// built from key prefixes of at most this many bytes, which lets range
+	// scans skip tables that hold no key in the range. Longer prefixes make
+	// the filter larger and more precise. Zero disables it.
+	RangeFilterMaxPrefixLength int
+}
+
+// defaultBlockCache is the block cache of DefaultOptions, shared by every
+// store in the process that does not bring its own.
+var defaultBlockCache = cache.NewCache(defaultBlockCacheSize, cache.LRU)
+
+const defaultBlockCacheSize = 8 << 20
+
+const defaultMaxOpenFiles = 1000
+
+func DefaultOptions() Options {
+	return Options{
+		BlockSize:            defaultBlockSize,
+		BlockRestartInterval: defaultBlockRestartInterval,
+		// Level 0 and 1 tables are short-lived, so they are written
+		// uncompressed; the fast codec is used below that and flate for the
+		// long-lived bottom of a default seven-level tree.
+		CompressionPerLevel: []Compressor{nil, nil, NewLZCompressor(), NewLZCompressor(), NewLZCompressor(), NewLZCompressor(), NewFlateCompressor(flate.DefaultCompression)},
+		BlockCache:          defaultBlockCache,
+		MaxOpenFiles:        defaultMaxOpenFiles,
+		FilterPolicy:        NewBloomFilterPolicy(0.01),
+	}
+}
+
+func (o Options) dictTrainingBytes() int {
+	if o.CompressionDictTrainingBytes > 0 {
+		return o.CompressionDictTrainingBytes
+	}
+	return 100 * o.CompressionDictSize
+}
+
+// compressorForLevel returns the compressor for tables written to level, or
+// nil to write them uncompressed.
+func (o Options) compressorForLevel(level int) Compressor {
+	if len(o.CompressionPerLevel) == 0 {
+		return nil
+	}
+	if level >= len(o.CompressionPerLevel) {
+		level = len(o.CompressionPerLevel) - 1
+	}
+	return o.CompressionPerLevel[level]
+}
@@ -0,0 +1,150 @@
+package sstable
+
+import "github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+
+// With Options.MetadataBlockSize set, the index is cut into partitions of
+// about that size, each listing a run of data blocks like an unpartitioned
+// index block does. The top-level index lists the partitions the same way,
+// by the last key each one covers. The key filter is partitioned along the
+// same runs of data blocks, with a top-level filter index of its own.
+//
+// Only the top-level blocks are held by the table reader. Partitions are
+// read when a lookup or scan reaches them and kept in the block cache like
+// data blocks, so the memory a table takes grows with the part of it being
+// read rather than with its size.
+
+const (
+	topLevelIndexBlockName       = "top-level-index"
+	partitionedFilterBlockPrefix = "partitioned-filter."
+)
+
+// indexEntryOverhead approximates the memory a decoded index entry takes
+// besides its key.
+const indexEntryOverhead = 48
+
+// writePartitions writes the partitions of the index and, with a filter
+// policy, of the key filter, followed by the top-level blocks locating them.
+func (w *Writer) writePartitions(metaIndex map[string]blockHandle) {
+	policy := w.sstable.opts.FilterPolicy
+	withFilter := policy != nil && len(w.hashes) > 0
+
+	var indexPartitions, filterPartitions []blockIndexEntry
+	var partition []byte
+	first := 0
+	for i, entry := range w.blocks {
+		partition = appendIndexEntry(partition, entry)
+		if len(partition) < w.sstable.opts.MetadataBlockSize && i < len(w.blocks)-1 {
+			continue
+		}
+
+		indexPartitions = append(indexPartitions, blockIndexEntry{
+			lastKey: entry.lastKey,
+			handle:  w.writeBlock(partition),
+		})
+		if withFilter {
+			hashes := w.hashes[w.blockHashStart(first):w.blockHashEnds[i]]
+			filterPartitions = append(filterPartitions, blockIndexEntry{
+				lastKey: entry.lastKey,
+				handle:  w.writeBlock(policy.CreateFilter(hashes)),
+			})
+		}
+		partition = partition[:0]
+		first = i + 1
+	}
+
+	metaIndex[topLevelIndexBlockName] = w.writeBlock(encodeIndexBlock(indexPartitions))
+	if withFilter {
+		metaIndex[partitionedFilterBlockPrefix+policy.Name()] = w.writeBlock(encodeIndexBlock(filterPartitions))
+	}
+	w.sstable.props.IndexPartitions = len(indexPartitions)
+}
+
+// blockHashStart returns the position in hashes of the first key of the i-th
+// data block.
+func (w *Writer) blockHashStart(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return w.blockHashEnds[i-1]
+}
+
+// numPartitions returns the number of index partitions. An unpartitioned
+// index counts as a single partition.
+func (r *tableReader) numPartitions() int {
+	if r.partitions == nil {
+		return 1
+	}
+	return len(r.partitions)
+}
+
+// findPartition returns the first index partition that may hold key.
+func (r *tableReader) findPartition(key string) int {
+	if r.partitions == nil {
+		return 0
+	}
+	return findBlock(r.partitions, key)
+}
+
+// readIndexPartition returns the data blocks listed in the p-th index
+// partition, from the block cache or from the file. The returned handle must
+// be released once the blocks are no longer used; it is nil for an
+// unpartitioned index or without a block cache.
+func (sst *SSTable) readIndexPartition(r *tableReader, p int) ([]blockIndexEntry, *cache.Handle, error) {
+	if r.partitions == nil {
+		return r.blocks, nil, nil
+	}
+	handle := r.partitions[p].handle
+	c := sst.opts.BlockCache
+	key := sst.blockCacheKey(handle.Offset)
+	if c != nil {
+		if h := c.Lookup(key); h != nil {
+			return h.Value().([]blockIndexEntry), h, nil
+		}
+	}
+
+	block, err := r.readBlock(handle)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks, err := decodeIndexBlock(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c == nil {
+		return blocks, nil, nil
+	}
+	charge := int64(0)
+	for _, entry := range blocks {
+		charge += int64(len(entry.lastKey) + indexEntryOverhead)
+	}
+	return blocks, c.Insert(key, blocks, charge), nil
+}
+
+// mayContainPartitioned checks key against the filter partition covering it.
+// Partitions read from a mapped file are slices of the mapping and bypass the
+// block cache, like uncompressed data blocks.
+func (sst *SSTable) mayContainPartitioned(r *tableReader, key string) bool {
+	i := findBlock(r.filterPartitions, key)
+	if i == len(r.filterPartitions) {
+		return false
+	}
+	handle := r.filterPartitions[i].handle
+
+	c := sst.opts.BlockCache
+	if c == nil || r.mapping != nil {
+		filter, err := r.readBlock(handle)
+		return err != nil || r.filterPolicy.MayContain(filter, keyHash(key))
+	}
+
+	cacheKey := sst.blockCacheKey(handle.Offset)
+	h := c.Lookup(cacheKey)
+	if h == nil {
+		filter, err := r.readBlock(handle)
+		if err != nil {
+			return true
+		}
+		h = c.Insert(cacheKey, filter, int64(len(filter)))
+	}
+	defer h.Release()
+	return r.filterPolicy.MayContain(h.Value().([]byte), keyHash(key))
+}
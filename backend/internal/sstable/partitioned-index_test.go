@@ -0,0 +1,65 @@
+package sstable
+
+import (
+	"testing"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+)
+
+func TestPartitionedIndex(t *testing.T) {
+	entries := tableEntries(2000)
+	for _, withCache := range []bool{false, true} {
+		name := "without block cache"
+		if withCache {
+			name = "with block cache"
+		}
+		t.Run(name, func(t *testing.T) {
+			opts := Options{
+				BlockSize:         512,
+				MetadataBlockSize: 256,
+				FilterPolicy:      NewBloomFilterPolicy(0.01),
+			}
+			if withCache {
+				opts.BlockCache = cache.NewCache(1<<20, cache.LRU)
+			}
+			sst := writeTable(t, t.TempDir(), "1.sst", entries, opts)
+			if n := sst.Properties().IndexPartitions; n < 2 {
+				t.Fatalf("index cut into %d partitions", n)
+			}
+			checkTable(t, sst, entries)
+
+			// The reader only holds the top-level blocks.
+			r, err := openTableReader(sst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.close(sst)
+			if r.blocks != nil || len(r.partitions) != sst.Properties().IndexPartitions {
+				t.Fatalf("reader holds %d index entries and %d partitions", len(r.blocks), len(r.partitions))
+			}
+			if r.filterPartitions == nil || r.filter != nil {
+				t.Fatal("reader holds the whole filter rather than its top-level block")
+			}
+
+			// The partitioned filter rules out missing keys.
+			falsePositives := 0
+			for _, entry := range entries {
+				if sst.MayContain(entry.Key + ".missing") {
+					falsePositives++
+				}
+			}
+			if falsePositives > len(entries)/50 {
+				t.Fatalf("%d of %d missing keys pass the filter", falsePositives, len(entries))
+			}
+		})
+	}
+}
+
+func TestUnpartitionedIndex(t *testing.T) {
+	entries := tableEntries(500)
+	sst := writeTable(t, t.TempDir(), "1.sst", entries, Options{BlockSize: 512})
+	if n := sst.Properties().IndexPartitions; n != 0 {
+		t.Fatalf("index cut into %d partitions without MetadataBlockSize", n)
+	}
+	checkTable(t, sst, entries)
+}
@@ -0,0 +1,89 @@
+package sstable
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PrefixExtractor maps keys to the prefix that prefix filters are built over
+// and prefix scans are restricted to. Keys outside its domain have no prefix
+// and are left out of prefix filters.
+//
+// The extractor name is stored in each table, and a prefix filter is only
+// used while the configured extractor has the same name.
+type PrefixExtractor interface {
+	Name() string
+	InDomain(key string) bool
+	Transform(key string) string
+}
+
+type fixedPrefixExtractor struct {
+	length int
+}
+
+// NewFixedPrefixExtractor uses the first length bytes of a key as its
+// prefix. Shorter keys have no prefix.
+func NewFixedPrefixExtractor(length int) PrefixExtractor {
+	return fixedPrefixExtractor{length: length}
+}
+
+func (e fixedPrefixExtractor) Name() string {
+	return fmt.Sprintf("fixed:%d", e.length)
+}
+
+func (e fixedPrefixExtractor) InDomain(key string) bool {
+	return len(key) >= e.length
+}
+
+func (e fixedPrefixExtractor) Transform(key string) string {
+	return key[:e.length]
+}
+
+type delimitedPrefixExtractor struct {
+	delimiter string
+	count     int
+}
+
+// NewDelimitedPrefixExtractor uses everything up to and including the
+// count-th delimiter as a key's prefix, so with "/" and 1 the prefix of
+// "tenant/entity/id" is "tenant/". Keys with fewer delimiters have no prefix.
+func NewDelimitedPrefixExtractor(delimiter string, count int) PrefixExtractor {
+	return delimitedPrefixExtractor{delimiter: delimiter, count: count}
+}
+
+func (e delimitedPrefixExtractor) Name() string {
+	return fmt.Sprintf("delimited:%q:%d", e.delimiter, e.count)
+}
+
+func (e delimitedPrefixExtractor) end(key string) int {
+	end := 0
+	for i := 0; i < e.count; i++ {
+		n := strings.Index(key[end:], e.delimiter)
+		if n < 0 {
+			return -1
+		}
+		end += n + len(e.delimiter)
+	}
+	return end
+}
+
+func (e delimitedPrefixExtractor) InDomain(key string) bool {
+	return e.end(key) >= 0
+}
+
+func (e delimitedPrefixExtractor) Transform(key string) string {
+	return key[:e.end(key)]
+}
+
+// PrefixSuccessor returns the smallest key greater than every key starting
+// with prefix, or "" if there is none.
+func PrefixSuccessor(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package sstable
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrefixExtractors(t *testing.T) {
+	tests := []struct {
+		extractor PrefixExtractor
+		key       string
+		want      string // empty if key is out of the domain
+	}{
+		{NewFixedPrefixExtractor(3), "abcdef", "abc"},
+		{NewFixedPrefixExtractor(3), "abc", "abc"},
+		{NewFixedPrefixExtractor(3), "ab", ""},
+		{NewDelimitedPrefixExtractor("/", 1), "tenant/entity/id", "tenant/"},
+		{NewDelimitedPrefixExtractor("/", 2), "tenant/entity/id", "tenant/entity/"},
+		{NewDelimitedPrefixExtractor("::", 1), "a::b", "a::"},
+		{NewDelimitedPrefixExtractor("/", 2), "tenant/id", ""},
+	}
+	for _, test := range tests {
+		e := test.extractor
+		if e.InDomain(test.key) != (test.want != "") {
+			t.Fatalf("%s: %q in domain %v", e.Name(), test.key, e.InDomain(test.key))
+		}
+		if test.want != "" && e.Transform(test.key) != test.want {
+			t.Fatalf("%s: prefix of %q is %q, want %q", e.Name(), test.key, e.Transform(test.key), test.want)
+		}
+	}
+}
+
+func TestPrefixSuccessor(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"abc":        "abd",
+		"a\xff":      "b",
+		"\xff\xff":   "",
+		"tenant/":    "tenant0",
+		"":           "",
+		"a\xff\xffz": "a\xff\xff{",
+	} {
+		if got := PrefixSuccessor(prefix); got != want {
+			t.Fatalf("successor of %q is %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+func TestPrefixFilter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "1.sst")
+	sst := NewSSTable(filename)
+	extractor := NewDelimitedPrefixExtractor("/", 1)
+	sst.opts = Options{FilterPolicy: NewBloomFilterPolicy(0.01), PrefixExtractor: extractor}
+	var entries []Entry
+	for _, tenant := range []string{"a", "c", "e"} {
+		for i := 0; i < 100; i++ {
+			entries = append(entries, Entry{Key: fmt.Sprintf("%s/%03d", tenant, i), Value: "v", Seq: uint64(len(entries) + 1)})
+		}
+	}
+	if err := sst.Write(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenSSTable(filename, Options{FilterPolicy: NewBloomFilterPolicy(0.01), PrefixExtractor: extractor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{"a/", "c/", "e/", "c", "c/0"} {
+		if !reopened.MayContainPrefix(prefix) {
+			t.Fatalf("table ruled out for prefix %q", prefix)
+		}
+	}
+	// Inside the table's key range, so only the prefix filter rules them out.
+	falsePositives := 0
+	for _, prefix := range []string{"b/", "bb/", "d/", "dd/", "ca/", "cb/"} {
+		if reopened.MayContainPrefix(prefix) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 1 {
+		t.Fatalf("%d of 6 missing prefixes pass the prefix filter", falsePositives)
+	}
+	if reopened.MayContainPrefix("f/") {
+		t.Fatal("table not ruled out for a prefix past its key range")
+	}
+
+	// The filter is ignored under an extractor it was not built with.
+	other, err := OpenSSTable(filename, Options{PrefixExtractor: NewFixedPrefixExtractor(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.MayContainPrefix("b/") {
+		t.Fatal("prefix filter used under a different extractor")
+	}
+}
@@ -0,0 +1,61 @@
+package sstable
+
+import "time"
+
+// Properties describe the contents of a table. They are computed while the
+// table is written and stored in its properties block.
+type Properties struct {
+	SmallestKey  string `json:"smallest_key"`
+	LargestKey   string `json:"largest_key"`
+	NumEntries   int64  `json:"num_entries"`
+	NumDeletions int64  `json:"num_deletions"`
+	RawKeySize   int64  `json:"raw_key_size"`
+	RawValueSize int64  `json:"raw_value_size"`
+	// RawDataSize is the size of the data blocks before compression and
+	// DataSize the size they take up in the file.
+	RawDataSize  int64     `json:"raw_data_size"`
+	DataSize     int64     `json:"data_size"`
+	MinSeq       uint64    `json:"min_seq"`
+	MaxSeq       uint64    `json:"max_seq"`
+	CreationTime time.Time `json:"creation_time"`
+	// NewestEntryTime is when the newest entry in the table was written by
+	// the client, which for compaction output may be long before the table
+	// was created.
+	NewestEntryTime time.Time `json:"newest_entry_time"`
+	Compression     string    `json:"compression"`
+	// FormatVersion is the encoding of the records in the data blocks.
+	FormatVersion int `json:"format_version,omitempty"`
+	// IndexPartitions is the number of partitions of a partitioned index.
+	IndexPartitions int `json:"index_partitions,omitempty"`
+	// CompressionDictSize is the size of the table's compression dictionary.
+	CompressionDictSize int `json:"compression_dict_size,omitempty"`
+	// PrefixExtractor names the extractor the prefix filter was built with.
+	PrefixExtractor string `json:"prefix_extractor,omitempty"`
+}
+
+// add accounts for an entry appended to the table.
+func (p *Properties) add(entry Entry) {
+	if p.NumEntries == 0 {
+		p.SmallestKey = entry.Key
+		p.MinSeq = entry.Seq
+	}
+	p.LargestKey = entry.Key
+	if entry.Seq < p.MinSeq {
+		p.MinSeq = entry.Seq
+	}
+	if entry.Seq > p.MaxSeq {
+		p.MaxSeq = entry.Seq
+	}
+
+	p.NumEntries++
+	if entry.Deleted {
+		p.NumDeletions++
+	}
+	p.RawKeySize += int64(len(entry.Key))
+	p.RawValueSize += int64(len(entry.Value))
+}
+
+// Contains reports whether key lies within the table's key range.
+func (p *Properties) Contains(key string) bool {
+	return p.NumEntries > 0 && key >= p.SmallestKey && key <= p.LargestKey
+}
@@ -0,0 +1,141 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+const rangeFilterBlockName = "range-filter"
+
+// rangeFilter answers whether a table may hold any key in a range. It stores,
+// in order, the shortest prefix of each key that tells it apart from its
+// neighbours, cut to at most maxLength bytes, which is the truncation a
+// SuRF-Base trie uses without the trie.
+//
+// Every stored prefix p is a prefix of some key k, so a key k in [a, b)
+// implies p < b and either p >= a or p is a prefix of a. If no stored prefix
+// satisfies that, the range is empty. Cutting prefixes shorter only makes
+// the filter less precise, never wrong.
+//
+// Encoded, the prefixes are delta-encoded against their predecessor as a
+// varint shared length, a varint suffix length and the suffix.
+type rangeFilter struct {
+	prefixes []string
+}
+
+// rangeFilterBuilder builds a range filter from keys added in order. A key's
+// prefix depends on the key after it, so each key is held back until the
+// next one arrives.
+type rangeFilterBuilder struct {
+	filter     rangeFilter
+	maxLength  int
+	pending    string
+	pendingLCP int
+	hasPending bool
+}
+
+func newRangeFilterBuilder(maxLength int) *rangeFilterBuilder {
+	return &rangeFilterBuilder{maxLength: maxLength}
+}
+
+func (b *rangeFilterBuilder) add(key string) {
+	lcp := 0
+	if b.hasPending {
+		lcp = commonPrefixLength(b.pending, key)
+		b.emit(lcp)
+	}
+	b.pending, b.pendingLCP, b.hasPending = key, lcp, true
+}
+
+// emit stores the prefix of the pending key, given its common prefix length
+// with the key after it.
+func (b *rangeFilterBuilder) emit(nextLCP int) {
+	length := b.pendingLCP
+	if nextLCP > length {
+		length = nextLCP
+	}
+	length++
+	if length > len(b.pending) {
+		length = len(b.pending)
+	}
+	if length > b.maxLength {
+		length = b.maxLength
+	}
+
+	prefix := b.pending[:length]
+	if n := len(b.filter.prefixes); n == 0 || b.filter.prefixes[n-1] != prefix {
+		b.filter.prefixes = append(b.filter.prefixes, prefix)
+	}
+}
+
+func (b *rangeFilterBuilder) finish() *rangeFilter {
+	if b.hasPending {
+		b.emit(0)
+		b.hasPending = false
+	}
+	return &b.filter
+}
+
+func commonPrefixLength(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func (f *rangeFilter) encode() []byte {
+	var buf []byte
+	var previous string
+	for _, prefix := range f.prefixes {
+		shared := commonPrefixLength(previous, prefix)
+		buf = binary.AppendUvarint(buf, uint64(shared))
+		buf = binary.AppendUvarint(buf, uint64(len(prefix)-shared))
+		buf = append(buf, prefix[shared:]...)
+		previous = prefix
+	}
+	return buf
+}
+
+func decodeRangeFilter(data []byte) (*rangeFilter, bool) {
+	f := &rangeFilter{}
+	var previous string
+	for len(data) > 0 {
+		shared, n := binary.Uvarint(data)
+		if n <= 0 || shared > uint64(len(previous)) {
+			return nil, false
+		}
+		data = data[n:]
+		suffixLength, n := binary.Uvarint(data)
+		if n <= 0 || suffixLength > uint64(len(data)-n) {
+			return nil, false
+		}
+		data = data[n:]
+
+		prefix := previous[:shared] + string(data[:suffixLength])
+		data = data[suffixLength:]
+		f.prefixes = append(f.prefixes, prefix)
+		previous = prefix
+	}
+	return f, true
+}
+
+// mayContainRange reports whether a key in [start, end) may exist. An empty
+// end leaves the range open.
+func (f *rangeFilter) mayContainRange(start, end string) bool {
+	below := func(p string) bool { return end == "" || p < end }
+
+	i := sort.SearchStrings(f.prefixes, start)
+	if i < len(f.prefixes) && below(f.prefixes[i]) {
+		return true
+	}
+	// A stored prefix of start stands for keys that may be at or after it.
+	for length := 1; length < len(start); length++ {
+		prefix := start[:length]
+		j := sort.SearchStrings(f.prefixes[:i], prefix)
+		if j < i && f.prefixes[j] == prefix && below(prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package sstable
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// randomKeys returns n distinct sorted keys of random lowercase letters.
+func randomKeys(rng *rand.Rand, n int) []string {
+	seen := make(map[string]bool)
+	for len(seen) < n {
+		key := make([]byte, 1+rng.Intn(8))
+		for i := range key {
+			key[i] = byte('a' + rng.Intn(26))
+		}
+		seen[string(key)] = true
+	}
+	keys := make([]string, 0, n)
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRangeFilter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, maxLength := range []int{1, 2, 4, 16} {
+		t.Run(fmt.Sprint(maxLength), func(t *testing.T) {
+			keys := randomKeys(rng, 200)
+			b := newRangeFilterBuilder(maxLength)
+			for _, key := range keys {
+				b.add(key)
+			}
+			filter := b.finish()
+
+			decoded, ok := decodeRangeFilter(filter.encode())
+			if !ok || !reflect.DeepEqual(decoded.prefixes, filter.prefixes) {
+				t.Fatalf("decoded prefixes %q, want %q", decoded.prefixes, filter.prefixes)
+			}
+
+			ruledOut := 0
+			for i := 0; i < 2000; i++ {
+				bounds := randomKeys(rng, 2)
+				start, end := bounds[0], bounds[1]
+				if i%10 == 0 {
+					end = ""
+				}
+				j := sort.SearchStrings(keys, start)
+				nonEmpty := j < len(keys) && (end == "" || keys[j] < end)
+				got := filter.mayContainRange(start, end)
+				if nonEmpty && !got {
+					t.Fatalf("[%q, %q) holds %q but is ruled out", start, end, keys[j])
+				}
+				if !got {
+					ruledOut++
+				}
+			}
+			if maxLength >= 4 && ruledOut == 0 {
+				t.Fatal("no empty range is ruled out")
+			}
+		})
+	}
+}
+
+func TestTableRangeFilter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "1.sst")
+	sst := NewSSTable(filename)
+	sst.opts = Options{RangeFilterMaxPrefixLength: 8}
+	var entries []Entry
+	for i, key := range []string{"apple", "apricot", "mango", "melon", "zucchini"} {
+		entries = append(entries, Entry{Key: key, Value: "v", Seq: uint64(i + 1)})
+	}
+	if err := sst.Write(entries); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenSSTable(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		start, end string
+		want       bool
+	}{
+		{"a", "b", true},
+		{"apricot", "apricou", true},
+		{"b", "m", false},
+		{"mb", "me", false},
+		{"n", "", true},
+		{"n", "z", false},
+		{"zz", "", false},
+	}
+	for _, test := range tests {
+		if got := reopened.MayContainRange(test.start, test.end); got != test.want {
+			t.Fatalf("[%q, %q): may contain %v, want %v", test.start, test.end, got, test.want)
+		}
+	}
+}
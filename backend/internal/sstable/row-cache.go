@@ -0,0 +1,120 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+)
+
+// With Options.RowCache set, the manager caches the newest version of the
+// keys it reads, so repeated lookups of hot keys skip the filters, index and
+// data blocks of every level. Each row keeps the version it holds, sequence
+// number included, and the table that version was read from:
+//
+//   - A row is only served while that table is live. Compactions that
+//     rewrite or drop the version, whether through a compaction filter or a
+//     FIFO deletion, retire the table and with it the row, while trivial
+//     moves keep both.
+//   - Newer versions are written to the memtable, which lookups check first,
+//     and InvalidateRow erases the row before they can be flushed to a table.
+//     A read only inserts its row if no key was invalidated at a sequence
+//     number past the one it was made at, so a read racing a write cannot
+//     cache the version the write replaced.
+//   - A row is only served to reads at or past the sequence number of the
+//     version it holds.
+//
+// Rows hold the newest version of a key, so only reads of the latest state
+// use the cache; a read at an older snapshot must bypass it.
+//
+// Hits still count as reads of the table, so its ReadHotnessScore keeps
+// reflecting the keys it serves. Keys found in no table are not cached.
+
+// rowEntryOverhead approximates the memory a cached row takes besides its
+// key and value.
+const rowEntryOverhead = 64
+
+type row struct {
+	entry Entry
+	table *SSTable
+}
+
+// rowInvalidations orders row inserts against InvalidateRow.
+type rowInvalidations struct {
+	// seq is the highest sequence number a row has been invalidated at.
+	seq   uint64
+	mutex sync.Mutex
+}
+
+// InvalidateRow drops the cached row for key. It must be called for every
+// write to key, with the write's sequence number, after the write is in the
+// memtable.
+func (m *SSTableManager) InvalidateRow(key string, seq uint64) {
+	if m.opts.RowCache == nil {
+		return
+	}
+	m.rowInvalidations.mutex.Lock()
+	defer m.rowInvalidations.mutex.Unlock()
+	m.rowInvalidations.seq = max(m.rowInvalidations.seq, seq)
+	m.opts.RowCache.Erase(m.rowCacheKey(key))
+}
+
+// getCached is get through the row cache for a read at sequence number
+// readSeq. Callers must hold the mutex.
+func (m *SSTableManager) getCached(key string, readSeq uint64) (Entry, bool, error) {
+	c := m.opts.RowCache
+	if c == nil {
+		entry, _, found, err := m.get(key)
+		return entry, found, err
+	}
+
+	cacheKey := m.rowCacheKey(key)
+	if h := c.Lookup(cacheKey); h != nil {
+		cached := h.Value().(row)
+		h.Release()
+		if !m.isLive(cached.table) {
+			c.Erase(cacheKey)
+		} else if cached.entry.Seq <= readSeq {
+			cached.table.recordRead(key)
+			return cached.entry, true, nil
+		}
+	}
+
+	entry, table, found, err := m.get(key)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	if found {
+		m.rowInvalidations.mutex.Lock()
+		if readSeq >= m.rowInvalidations.seq {
+			charge := int64(len(key) + len(entry.Value) + rowEntryOverhead)
+			c.Insert(cacheKey, row{entry: entry, table: table}, charge).Release()
+		}
+		m.rowInvalidations.mutex.Unlock()
+	}
+	return entry, found, nil
+}
+
+// isLive reports whether sst is one of the manager's tables. Callers must
+// hold the mutex.
+func (m *SSTableManager) isLive(sst *SSTable) bool {
+	if sst.level >= len(m.levels) {
+		return false
+	}
+	tables := m.levels[sst.level]
+	if sst.level == 0 {
+		for _, t := range tables {
+			if t == sst {
+				return true
+			}
+		}
+		return false
+	}
+	i := sort.Search(len(tables), func(i int) bool { return tables[i].props.SmallestKey >= sst.props.SmallestKey })
+	return i < len(tables) && tables[i] == sst
+}
+
+func (m *SSTableManager) rowCacheKey(key string) string {
+	var id [8]byte
+	binary.LittleEndian.PutUint64(id[:], m.rowCacheID)
+	return string(id[:]) + key
+}
@@ -0,0 +1,104 @@
+package sstable
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+)
+
+func newTestManager(t *testing.T, opts Options) *SSTableManager {
+	t.Helper()
+	m := NewSSTableManager(t.TempDir(), opts)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func mustRead(t *testing.T, m *SSTableManager, key string, readSeq uint64) (string, bool) {
+	t.Helper()
+	value, found, err := m.Read(key, readSeq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value, found
+}
+
+func TestRowCache(t *testing.T) {
+	c := cache.NewCache(1<<20, cache.LRU)
+	m := newTestManager(t, Options{RowCache: c})
+	if err := m.CreateSSTable([]Entry{{Key: "a", Value: "1", Seq: 1}, {Key: "b", Value: "2", Seq: 2}}, 2, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if value, found := mustRead(t, m, "a", math.MaxUint64); !found || value != "1" {
+			t.Fatalf("got %q, %v", value, found)
+		}
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Inserts != 1 {
+		t.Fatalf("stats %+v after reading a key twice", stats)
+	}
+
+	// Missing keys are not cached.
+	mustRead(t, m, "c", math.MaxUint64)
+	if stats := c.Stats(); stats.Inserts != 1 {
+		t.Fatalf("stats %+v after reading a missing key", stats)
+	}
+
+	// A read made before a write to the key must not cache what it found.
+	m.InvalidateRow("b", 10)
+	mustRead(t, m, "b", 9)
+	if stats := c.Stats(); stats.Inserts != 1 {
+		t.Fatalf("stats %+v after a read older than an invalidation", stats)
+	}
+	mustRead(t, m, "b", 10)
+	if stats := c.Stats(); stats.Inserts != 2 {
+		t.Fatalf("stats %+v after a read at the invalidation", stats)
+	}
+}
+
+func TestRowCacheDropsRowsOfRetiredTables(t *testing.T) {
+	m := newTestManager(t, Options{RowCache: cache.NewCache(1<<20, cache.LRU)})
+	if err := m.CreateSSTable([]Entry{{Key: "a", Value: "old", Seq: 1}}, 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	mustRead(t, m, "a", math.MaxUint64)
+
+	// A compaction rewrites the key, as a compaction filter might.
+	input := m.Levels()[0][0]
+	output := m.NewTable(1)
+	if err := output.Write([]Entry{{Key: "a", Value: "filtered", Seq: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.InstallCompaction([]*SSTable{input}, []*SSTable{output}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := mustRead(t, m, "a", math.MaxUint64); value != "filtered" {
+		t.Fatalf("got %q from a row of a compacted table", value)
+	}
+}
+
+func TestRowCacheSharedByManagers(t *testing.T) {
+	c := cache.NewCache(1<<20, cache.LRU)
+	first := newTestManager(t, Options{RowCache: c})
+	second := newTestManager(t, Options{RowCache: c})
+	for i, m := range []*SSTableManager{first, second} {
+		value := []string{"first", "second"}[i]
+		if err := m.CreateSSTable([]Entry{{Key: "a", Value: value, Seq: 1}}, 1, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if value, _ := mustRead(t, first, "a", math.MaxUint64); value != "first" {
+			t.Fatalf("first store read %q", value)
+		}
+		if value, _ := mustRead(t, second, "a", math.MaxUint64); value != "second" {
+			t.Fatalf("second store read %q", value)
+		}
+	}
+}
@@ -1,61 +1,155 @@
 package sstable
 
 import (
-	"encoding/binary"
-	"os"
+	"io"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
 )
 
+// Scanner iterates over the entries of an SSTable in key order, optionally
+// limited to the keys in [start, end). It reads one data block, and one
+// index partition, at a time.
 type Scanner struct {
-	sstable *SSTable
-	file    *os.File
-	offset  int64
+	sstable     *SSTable
+	table       *tableReader
+	partition   int
+	blocks      []blockIndexEntry
+	indexHandle *cache.Handle
+	block       int
+	reader      *blockReader
+	handle      *cache.Handle
+	start       string
+	end         string
+	next        *Entry
+	err         error
+}
+
+func (sst *SSTable) NewScanner() (*Scanner, error) {
+	return sst.NewRangeScanner("", "")
 }
 
-func (sst *SSTable) NewScanner() *Scanner {
-	file, err := os.Open(sst.filename)
+// NewRangeScanner returns a scanner over the keys in [start, end). An empty
+// end means the scan runs to the end of the table. The scanner keeps the
+// table's reader open until it is closed.
+func (sst *SSTable) NewRangeScanner(start, end string) (*Scanner, error) {
+	r, err := sst.tableCache.acquire(sst)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return &Scanner{
-		sstable: sst,
-		file:    file,
-		offset:  0,
+	scanner := &Scanner{
+		sstable:   sst,
+		table:     r,
+		partition: r.findPartition(start),
+		start:     start,
+		end:       end,
 	}
+	scanner.advance()
+	return scanner, nil
 }
 
-func (scanner *Scanner) HasNext() bool {
-	// Implement this method to check if there are more partitions to scan
-	return scanner.offset < scanner.sstable.Size()
+func (scanner *Scanner) advance() {
+	scanner.next = nil
+	for {
+		if scanner.reader == nil {
+			if scanner.block == len(scanner.blocks) {
+				if !scanner.nextPartition() {
+					return
+				}
+				continue
+			}
+			data, handle, err := scanner.sstable.readDataBlock(scanner.table, scanner.blocks[scanner.block])
+			if err != nil {
+				scanner.err = err
+				return
+			}
+			scanner.block++
+			scanner.handle = handle
+			reader, err := newBlockReader(data)
+			if err == nil {
+				err = reader.seek(scanner.start)
+			}
+			if err != nil {
+				scanner.err = err
+				return
+			}
+			scanner.reader = reader
+		}
+
+		entry, err := scanner.reader.next()
+		if err == io.EOF {
+			scanner.reader = nil
+			scanner.handle.Release()
+			continue
+		}
+		if err != nil {
+			scanner.err = err
+			return
+		}
+		if entry.Key < scanner.start {
+			continue
+		}
+		if scanner.end != "" && entry.Key >= scanner.end {
+			return
+		}
+		scanner.next = &entry
+		return
+	}
 }
 
-func (scanner *Scanner) Next() (string, string) {
-	// Implement this method to read the next partition
-	var keySize, valueSize int64
-	binary.Read(scanner.file, binary.LittleEndian, &keySize)
-	binary.Read(scanner.file, binary.LittleEndian, &valueSize)
+// nextPartition moves on to the next index partition, reporting false at the
+// end of the table.
+func (scanner *Scanner) nextPartition() bool {
+	scanner.indexHandle.Release()
+	scanner.blocks, scanner.indexHandle, scanner.block = nil, nil, 0
+	if scanner.partition == scanner.table.numPartitions() {
+		return false
+	}
 
-	keyBytes := make([]byte, keySize)
-	valueBytes := make([]byte, valueSize)
+	blocks, handle, err := scanner.sstable.readIndexPartition(scanner.table, scanner.partition)
+	if err != nil {
+		scanner.err = err
+		return false
+	}
+	scanner.partition++
+	scanner.blocks, scanner.indexHandle = blocks, handle
+	scanner.block = findBlock(blocks, scanner.start)
+	return true
+}
 
-	scanner.file.Read(keyBytes)
-	scanner.file.Read(valueBytes)
+func (scanner *Scanner) HasNext() bool {
+	return scanner.next != nil
+}
 
-	scanner.offset += 8 + 8 + keySize + valueSize
+func (scanner *Scanner) Next() Entry {
+	entry := *scanner.next
+	scanner.advance()
+	return entry
+}
 
-	return string(keyBytes), string(valueBytes)
+// Peek returns the next entry without advancing the scanner.
+func (scanner *Scanner) Peek() Entry {
+	return *scanner.next
 }
 
 func (scanner *Scanner) PeekKey() string {
-	// Implement this method to peek the next key without advancing the scanner
-	currentOffset := scanner.offset
-	var keySize int64
-	binary.Read(scanner.file, binary.LittleEndian, &keySize)
+	return scanner.next.Key
+}
 
-	keyBytes := make([]byte, keySize)
-	scanner.file.Read(keyBytes)
+func (scanner *Scanner) SSTable() *SSTable {
+	return scanner.sstable
+}
 
-	scanner.offset = currentOffset
-	scanner.file.Seek(currentOffset, 0)
+// Err returns the first read error other than reaching the end of the table.
+func (scanner *Scanner) Err() error {
+	return scanner.err
+}
 
-	return string(keyBytes)
+func (scanner *Scanner) Close() error {
+	scanner.handle.Release()
+	scanner.indexHandle.Release()
+	if scanner.table != nil {
+		scanner.sstable.tableCache.release(scanner.sstable, scanner.table)
+		scanner.table = nil
+	}
+	return nil
 }
@@ -1,33 +1,205 @@
 package sstable
 
 import (
-	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 )
 
 type SSTable struct {
-	filename      string
-	index         map[string]int64
-	size          int64
+	filename string
+	number   int
+	level    int
+	size     int64
+	props    Properties
+	opts     Options
+	cacheID  uint64
+	// tableCache keeps the table's reader open between reads. Tables not
+	// owned by a manager have none and open a reader for every read.
+	tableCache    *tableCache
 	readCounts    map[string]int64
 	lastReadTimes map[string]time.Time
+	statsMutex    sync.Mutex
 }
 
 func NewSSTable(filename string) *SSTable {
 	return &SSTable{
 		filename:      filename,
-		index:         make(map[string]int64),
 		readCounts:    make(map[string]int64),
 		lastReadTimes: make(map[string]time.Time),
 	}
 }
 
+// OpenSSTable loads an SSTable written by a previous process. Only its
+// properties are read here; the index and filters are loaded when the table
+// is first read.
+func OpenSSTable(filename string, opts Options) (*SSTable, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	sst := NewSSTable(filename)
+	sst.opts = opts
+	sst.size = info.Size()
+	if opts.BlockCache != nil {
+		sst.cacheID = opts.BlockCache.NewID()
+	}
+
+	metaIndexHandle, err := readFooter(file, sst.size)
+	if err == nil {
+		err = sst.readProperties(file, metaIndexHandle)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("corrupt sstable %s: %v", filename, err)
+	}
+	return sst, nil
+}
+
+func (sst *SSTable) readProperties(file *os.File, metaIndexHandle blockHandle) error {
+	metaIndex, err := readMetaIndex(file, sst.size, metaIndexHandle)
+	if err != nil {
+		return err
+	}
+	handle, ok := metaIndex[propertiesBlockName]
+	if !ok {
+		return fmt.Errorf("missing properties block")
+	}
+	block, err := readBlock(file, sst.size, handle)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(block, &sst.props); err != nil {
+		return fmt.Errorf("corrupt properties block: %v", err)
+	}
+	if sst.props.FormatVersion != formatPrefixCompressed {
+		return fmt.Errorf("unknown data block format %d", sst.props.FormatVersion)
+	}
+	return nil
+}
+
+func (sst *SSTable) Number() int {
+	return sst.number
+}
+
+func (sst *SSTable) Level() int {
+	return sst.level
+}
+
 func (sst *SSTable) Size() int64 {
 	return sst.size
 }
 
+func (sst *SSTable) Smallest() string {
+	return sst.props.SmallestKey
+}
+
+func (sst *SSTable) Largest() string {
+	return sst.props.LargestKey
+}
+
+func (sst *SSTable) MaxSeq() uint64 {
+	return sst.props.MaxSeq
+}
+
+// CreatedAt is when the table was written. Since tables are immutable, none
+// of its entries is newer than this.
+func (sst *SSTable) CreatedAt() time.Time {
+	return sst.props.CreationTime
+}
+
+// NewestEntryTime is when the newest entry in the table was written.
+func (sst *SSTable) NewestEntryTime() time.Time {
+	return sst.props.NewestEntryTime
+}
+
+func (sst *SSTable) Properties() Properties {
+	return sst.props
+}
+
+// Overlaps reports whether the table's key range intersects [start, end].
+func (sst *SSTable) Overlaps(start, end string) bool {
+	return sst.props.SmallestKey <= end && sst.props.LargestKey >= start
+}
+
+// MayContain reports whether key may be in the table, judging only by its key
+// range and filter.
+func (sst *SSTable) MayContain(key string) bool {
+	if !sst.props.Contains(key) {
+		return false
+	}
+	r, err := sst.tableCache.acquire(sst)
+	if err != nil {
+		return true
+	}
+	defer sst.tableCache.release(sst, r)
+	return sst.mayContain(r, key)
+}
+
+func (sst *SSTable) mayContain(r *tableReader, key string) bool {
+	if r.filterPolicy == nil {
+		return true
+	}
+	if r.filterPartitions != nil {
+		return sst.mayContainPartitioned(r, key)
+	}
+	return r.filterPolicy.MayContain(r.filter, keyHash(key))
+}
+
+// MayContainRange reports whether the table may hold a key in [start, end),
+// judging by its key range and range filter. An empty end leaves the range
+// open.
+func (sst *SSTable) MayContainRange(start, end string) bool {
+	if sst.props.NumEntries == 0 || sst.props.LargestKey < start || (end != "" && sst.props.SmallestKey >= end) {
+		return false
+	}
+	r, err := sst.tableCache.acquire(sst)
+	if err != nil {
+		return true
+	}
+	defer sst.tableCache.release(sst, r)
+	return r.rangeFilter == nil || r.rangeFilter.mayContainRange(start, end)
+}
+
+// MayContainPrefix reports whether the table may hold a key starting with
+// prefix, judging by its key range and, when prefix is a whole prefix under
+// the configured extractor, its prefix filter.
+func (sst *SSTable) MayContainPrefix(prefix string) bool {
+	if sst.props.NumEntries == 0 || sst.props.LargestKey < prefix {
+		return false
+	}
+	if end := PrefixSuccessor(prefix); end != "" && sst.props.SmallestKey >= end {
+		return false
+	}
+
+	extractor := sst.opts.PrefixExtractor
+	if extractor == nil || extractor.Name() != sst.props.PrefixExtractor {
+		return true
+	}
+	if !extractor.InDomain(prefix) || extractor.Transform(prefix) != prefix {
+		return true
+	}
+	r, err := sst.tableCache.acquire(sst)
+	if err != nil {
+		return true
+	}
+	defer sst.tableCache.release(sst, r)
+	return r.prefixPolicy == nil || r.prefixPolicy.MayContain(r.prefixFilter, keyHash(prefix))
+}
+
 func (sst *SSTable) ReadHotnessScore() int64 {
+	sst.statsMutex.Lock()
+	defer sst.statsMutex.Unlock()
+
 	var totalScore int64
 	for key, count := range sst.readCounts {
 		timeSinceLastRead := time.Since(sst.lastReadTimes[key]).Seconds()
@@ -40,57 +212,95 @@ func (sst *SSTable) ReadHotnessScore() int64 {
 	return totalScore
 }
 
-func (sst *SSTable) Write(data map[string]string) error {
-	file, err := os.Create(sst.filename)
+// Write stores entries, which must be sorted by key with one version per key.
+func (sst *SSTable) Write(entries []Entry) error {
+	writer, err := sst.NewWriter()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	var offset int64 = 0
-	for key, value := range data {
-		keySize := int64(len(key))
-		valueSize := int64(len(value))
-
-		binary.Write(file, binary.LittleEndian, keySize)
-		binary.Write(file, binary.LittleEndian, valueSize)
-		file.Write([]byte(key))
-		file.Write([]byte(value))
 
-		sst.index[key] = offset
-		offset += 8 + 8 + keySize + valueSize
+	for _, entry := range entries {
+		if err := writer.Add(entry); err != nil {
+			writer.Abort()
+			return err
+		}
 	}
-	sst.size += offset
-
-	return nil
+	return writer.Finish()
 }
 
-func (sst *SSTable) Read(key string) (string, bool) {
-	offset, ok := sst.index[key]
-	if !ok {
-		return "", false
+// Read returns the version of key stored in the table, which may be a
+// tombstone. An error means the table could not be read, not that it lacks
+// the key.
+func (sst *SSTable) Read(key string) (Entry, bool, error) {
+	if !sst.props.Contains(key) {
+		return Entry{}, false, nil
 	}
-
-	file, err := os.Open(sst.filename)
+	r, err := sst.tableCache.acquire(sst)
 	if err != nil {
-		return "", false
+		return Entry{}, false, err
 	}
-	defer file.Close()
-
-	file.Seek(offset, 0)
+	defer sst.tableCache.release(sst, r)
 
-	var keySize, valueSize int64
-	binary.Read(file, binary.LittleEndian, &keySize)
-	binary.Read(file, binary.LittleEndian, &valueSize)
+	if !sst.mayContain(r, key) {
+		return Entry{}, false, nil
+	}
+	p := r.findPartition(key)
+	if p == r.numPartitions() {
+		return Entry{}, false, nil
+	}
+	blocks, indexHandle, err := sst.readIndexPartition(r, p)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	defer indexHandle.Release()
+	i := findBlock(blocks, key)
+	if i == len(blocks) {
+		return Entry{}, false, nil
+	}
 
-	keyBytes := make([]byte, keySize)
-	valueBytes := make([]byte, valueSize)
+	data, handle, err := sst.readDataBlock(r, blocks[i])
+	if err != nil {
+		return Entry{}, false, err
+	}
+	defer handle.Release()
 
-	file.Read(keyBytes)
-	file.Read(valueBytes)
+	block, err := newBlockReader(data)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	if err := block.seek(key); err != nil {
+		return Entry{}, false, err
+	}
+	for {
+		entry, err := block.next()
+		if err == io.EOF {
+			return Entry{}, false, nil
+		}
+		if err != nil {
+			return Entry{}, false, err
+		}
+		if entry.Key > key {
+			return Entry{}, false, nil
+		}
+		if entry.Key != key {
+			continue
+		}
+		sst.recordRead(key)
+		return entry, true, nil
+	}
+}
 
+// recordRead counts a read of key towards the table's ReadHotnessScore.
+func (sst *SSTable) recordRead(key string) {
+	sst.statsMutex.Lock()
+	defer sst.statsMutex.Unlock()
 	sst.readCounts[key]++
 	sst.lastReadTimes[key] = time.Now()
+}
 
-	return string(valueBytes), true
+// Remove deletes the table's file. Readers still in use keep it open until
+// they are done.
+func (sst *SSTable) Remove() error {
+	sst.tableCache.drop(sst)
+	return os.Remove(sst.filename)
 }
@@ -0,0 +1,135 @@
+package sstable
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tableEntries returns sorted entries whose values alternate between runs of
+// compressible and random data, so compressed and raw blocks mix in a table.
+func tableEntries(n int) []Entry {
+	rng := rand.New(rand.NewSource(4))
+	entries := make([]Entry, n)
+	for i := range entries {
+		value := make([]byte, 200)
+		if (i/20)%2 == 0 {
+			copy(value, fmt.Sprintf("{\"id\":%d,\"plan\":\"free\",\"active\":true}", i))
+		} else {
+			rng.Read(value)
+		}
+		entries[i] = Entry{Key: fmt.Sprintf("key%06d", i), Value: string(value), Seq: uint64(i + 1)}
+		if i%13 == 5 {
+			entries[i].Value, entries[i].Deleted = "", true
+		}
+	}
+	return entries
+}
+
+func checkTable(t *testing.T, sst *SSTable, entries []Entry) {
+	t.Helper()
+	for _, want := range entries {
+		got, ok, err := sst.Read(want.Key)
+		if err != nil || !ok || got != want {
+			t.Fatalf("read %s: got %+v, %v, %v", want.Key, got, ok, err)
+		}
+	}
+	if _, ok, err := sst.Read("key"); ok || err != nil {
+		t.Fatalf("read a key missing from the table: %v, %v", ok, err)
+	}
+
+	scanner, err := sst.NewScanner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+	i := 0
+	for ; scanner.HasNext(); i++ {
+		got := scanner.Next()
+		if i >= len(entries) || got != entries[i] {
+			t.Fatalf("scan record %d: got %+v", i, got)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(entries) {
+		t.Fatalf("scanned %d records, want %d", i, len(entries))
+	}
+}
+
+// Tables record the codec of every block and their dictionary, so they read
+// back under options configuring neither.
+func TestTablesReadWithAnyCompression(t *testing.T) {
+	tests := []struct {
+		name       string
+		compressor Compressor
+		dictSize   int
+	}{
+		{"none", nil, 0},
+		{"flate", NewFlateCompressor(flate.DefaultCompression), 0},
+		{"lz", NewLZCompressor(), 0},
+		{"flate with dictionary", NewFlateCompressor(flate.DefaultCompression), 1024},
+		{"lz with dictionary", NewLZCompressor(), 1024},
+	}
+	entries := tableEntries(500)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "1.sst")
+			sst := NewSSTable(filename)
+			sst.opts = Options{
+				BlockSize:                    1024,
+				BlockRestartInterval:         4,
+				CompressionPerLevel:          []Compressor{test.compressor},
+				CompressionDictSize:          test.dictSize,
+				CompressionDictTrainingBytes: 8 * 1024,
+				FilterPolicy:                 NewBloomFilterPolicy(0.01),
+			}
+			if err := sst.Write(entries); err != nil {
+				t.Fatal(err)
+			}
+			checkTable(t, sst, entries)
+
+			reopened, err := OpenSSTable(filename, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := reopened.Properties().Compression, compressorName(test.compressor); got != want {
+				t.Fatalf("compression %q, want %q", got, want)
+			}
+			if test.dictSize > 0 && reopened.Properties().CompressionDictSize == 0 {
+				t.Fatal("table written without a dictionary")
+			}
+			checkTable(t, reopened, entries)
+		})
+	}
+}
+
+func TestReadReportsCorruptBlocks(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "1.sst")
+	sst := NewSSTable(filename)
+	sst.opts = Options{FilterPolicy: NewBloomFilterPolicy(0.01)}
+	entries := tableEntries(100)
+	if err := sst.Write(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first data block starts the file; make its first record unreadable.
+	file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt(bytes.Repeat([]byte{0xff}, 16), 0)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found, err := sst.Read(entries[0].Key); err == nil {
+		t.Fatalf("read a corrupt block without error, found %v", found)
+	}
+}
@@ -0,0 +1,150 @@
+package sstable
+
+import (
+	"container/list"
+	"sync"
+)
+
+// tableCache keeps the readers of recently used tables open, up to
+// Options.MaxOpenFiles of them, closing the least recently used one when a
+// new table is opened. Readers in use are never closed; the cache goes over
+// its limit instead. A nil tableCache opens a reader for every use.
+type tableCache struct {
+	maxOpenFiles int
+	readers      map[*SSTable]*tableReader
+	// lru holds the tables whose readers are open but not in use, most
+	// recently released first.
+	lru   *list.List
+	mutex sync.Mutex
+}
+
+func newTableCache(maxOpenFiles int) *tableCache {
+	return &tableCache{
+		maxOpenFiles: maxOpenFiles,
+		readers:      make(map[*SSTable]*tableReader),
+		lru:          list.New(),
+	}
+}
+
+// acquire returns the table's reader, opening it if needed. It must be given
+// back with release.
+func (c *tableCache) acquire(sst *SSTable) (*tableReader, error) {
+	if c == nil {
+		return openTableReader(sst)
+	}
+
+	c.mutex.Lock()
+	if r, ok := c.readers[sst]; ok {
+		c.ref(r)
+		c.mutex.Unlock()
+		return r, nil
+	}
+	c.mutex.Unlock()
+
+	// The file is opened without the mutex held, so a slow open does not
+	// hold up reads of other tables. If another reader for the table was
+	// added meanwhile, that one is used.
+	opened, err := openTableReader(sst)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	r, ok := c.readers[sst]
+	if ok {
+		c.ref(r)
+	} else {
+		r = opened
+		r.refs = 1
+		c.readers[sst] = r
+		c.evict()
+	}
+	c.mutex.Unlock()
+
+	if ok {
+		opened.close(sst)
+	}
+	return r, nil
+}
+
+func (c *tableCache) release(sst *SSTable, r *tableReader) {
+	if c == nil {
+		r.close(sst)
+		return
+	}
+
+	c.mutex.Lock()
+	r.refs--
+	closeReader := r.refs == 0 && r.obsolete
+	if r.refs == 0 && !r.obsolete {
+		r.element = c.lru.PushFront(sst)
+		c.evict()
+	}
+	c.mutex.Unlock()
+
+	if closeReader {
+		r.close(sst)
+	}
+}
+
+// ref marks r as in use. Callers must hold the mutex.
+func (c *tableCache) ref(r *tableReader) {
+	if r.refs == 0 && r.element != nil {
+		c.lru.Remove(r.element)
+		r.element = nil
+	}
+	r.refs++
+}
+
+// evict closes unused readers until the cache is within its limit. Callers
+// must hold the mutex.
+func (c *tableCache) evict() {
+	for c.maxOpenFiles > 0 && len(c.readers) > c.maxOpenFiles && c.lru.Len() > 0 {
+		sst := c.lru.Remove(c.lru.Back()).(*SSTable)
+		r := c.readers[sst]
+		delete(c.readers, sst)
+		r.element = nil
+		r.close(sst)
+	}
+}
+
+// drop closes the table's reader once it is no longer in use, for a table
+// that is being deleted or a cache that is being closed.
+func (c *tableCache) drop(sst *SSTable) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	r, ok := c.readers[sst]
+	if !ok {
+		c.mutex.Unlock()
+		return
+	}
+	delete(c.readers, sst)
+	if r.refs > 0 {
+		r.obsolete = true
+		c.mutex.Unlock()
+		return
+	}
+	c.lru.Remove(r.element)
+	r.element = nil
+	c.mutex.Unlock()
+
+	r.close(sst)
+}
+
+// close closes every reader not in use; readers still in use are closed
+// when they are released.
+func (c *tableCache) close() {
+	c.mutex.Lock()
+	tables := make([]*SSTable, 0, len(c.readers))
+	for sst := range c.readers {
+		tables = append(tables, sst)
+	}
+	c.mutex.Unlock()
+
+	for _, sst := range tables {
+		c.drop(sst)
+	}
+}
@@ -0,0 +1,100 @@
+package sstable
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// cachedTables writes n tables whose readers are kept by c.
+func cachedTables(t *testing.T, c *tableCache, n int) ([]*SSTable, []Entry) {
+	t.Helper()
+	dir := t.TempDir()
+	entries := tableEntries(100)
+	tables := make([]*SSTable, n)
+	for i := range tables {
+		tables[i] = writeTable(t, dir, fmt.Sprintf("%d.sst", i), entries, Options{})
+		tables[i].tableCache = c
+	}
+	return tables, entries
+}
+
+func (c *tableCache) openReaders() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.readers)
+}
+
+func TestTableCacheKeepsRecentReadersOpen(t *testing.T) {
+	c := newTableCache(2)
+	tables, entries := cachedTables(t, c, 3)
+
+	for _, sst := range tables {
+		checkTable(t, sst, entries)
+	}
+	if n := c.openReaders(); n != 2 {
+		t.Fatalf("%d readers open, want 2", n)
+	}
+	// The least recently used table was closed and is opened again.
+	checkTable(t, tables[0], entries)
+	c.mutex.Lock()
+	_, first := c.readers[tables[0]]
+	_, second := c.readers[tables[1]]
+	c.mutex.Unlock()
+	if !first || second {
+		t.Fatal("the least recently used reader was not the one closed")
+	}
+}
+
+func TestTableCacheNeverClosesReadersInUse(t *testing.T) {
+	c := newTableCache(1)
+	tables, _ := cachedTables(t, c, 3)
+
+	var readers []*tableReader
+	for _, sst := range tables {
+		r, err := c.acquire(sst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers = append(readers, r)
+	}
+	if n := c.openReaders(); n != 3 {
+		t.Fatalf("%d readers open while all are in use, want 3", n)
+	}
+	for i, r := range readers {
+		c.release(tables[i], r)
+	}
+	if n := c.openReaders(); n != 1 {
+		t.Fatalf("%d readers open after all were released, want 1", n)
+	}
+}
+
+func TestTableCacheDropClosesReaderAfterUse(t *testing.T) {
+	c := newTableCache(0)
+	tables, entries := cachedTables(t, c, 1)
+	sst := tables[0]
+
+	r, err := c.acquire(sst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sst.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	// The deleted table stays readable through the reader in use.
+	if _, err := r.readBlock(r.blocks[0].handle); err != nil {
+		t.Fatalf("reader in use failed after the table was removed: %v", err)
+	}
+	if n := c.openReaders(); n != 0 {
+		t.Fatalf("%d readers open after the table was removed", n)
+	}
+
+	c.release(sst, r)
+	if _, err := r.file.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("reader not closed after its last use: %v", err)
+	}
+	if _, _, err := sst.Read(entries[0].Key); err == nil {
+		t.Fatal("read a removed table")
+	}
+}
@@ -0,0 +1,214 @@
+package sstable
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/cache"
+)
+
+// tableReader holds what reading a table takes beyond its properties: the
+// open file and the parsed block index, filters and dictionary. For a table
+// with a partitioned index and filter, only their top-level blocks are held,
+// in partitions and filterPartitions. Readers are kept by the table cache
+// and reopened when it has evicted them.
+//
+// With Options.UseMmapReads the file is also mapped into memory and blocks
+// are sliced out of the mapping rather than read into buffers. Slices of the
+// mapping are only valid while the reader is, so they never go into the block
+// cache, and the mapping is only removed once the table cache has closed the
+// reader, after every user has released it.
+type tableReader struct {
+	file             *os.File
+	size             int64
+	mapping          []byte
+	blocks           []blockIndexEntry
+	partitions       []blockIndexEntry
+	dict             []byte
+	filter           []byte
+	filterPartitions []blockIndexEntry
+	filterPolicy     FilterPolicy
+	prefixFilter     []byte
+	prefixPolicy     FilterPolicy
+	rangeFilter      *rangeFilter
+	pinned           []*cache.Handle
+
+	// Guarded by the table cache's mutex.
+	refs     int
+	obsolete bool
+	element  *list.Element
+}
+
+// openTableReader opens the table's file and loads its meta blocks.
+func openTableReader(sst *SSTable) (*tableReader, error) {
+	file, err := os.Open(sst.filename)
+	if err != nil {
+		return nil, err
+	}
+	r := &tableReader{file: file, size: sst.size}
+	if sst.opts.UseMmapReads && sst.size > 0 {
+		// Reads go through the file if it cannot be mapped.
+		if mapping, err := mmapFile(file, sst.size); err == nil {
+			r.mapping = mapping
+		}
+	}
+
+	metaIndexHandle, err := readFooter(file, sst.size)
+	if err == nil {
+		err = r.readMetaBlocks(sst, metaIndexHandle)
+	}
+	if err == nil && r.blocks == nil && r.partitions == nil {
+		err = fmt.Errorf("missing index block")
+	}
+	if err != nil {
+		r.close(sst)
+		return nil, fmt.Errorf("corrupt sstable %s: %v", sst.filename, err)
+	}
+	return r, nil
+}
+
+func (r *tableReader) readMetaBlocks(sst *SSTable, metaIndexHandle blockHandle) error {
+	metaIndex, err := readMetaIndex(r.file, r.size, metaIndexHandle)
+	if err != nil {
+		return err
+	}
+
+	if handle, ok := metaIndex[indexBlockName]; ok {
+		block, err := r.readBlock(handle)
+		if err != nil {
+			return err
+		}
+		if r.blocks, err = decodeIndexBlock(block); err != nil {
+			return err
+		}
+		if r.blocks == nil {
+			r.blocks = []blockIndexEntry{}
+		}
+		r.pin(sst, handle)
+	}
+
+	if handle, ok := metaIndex[topLevelIndexBlockName]; ok {
+		block, err := r.readBlock(handle)
+		if err != nil {
+			return err
+		}
+		if r.partitions, err = decodeIndexBlock(block); err != nil {
+			return err
+		}
+		if r.partitions == nil {
+			r.partitions = []blockIndexEntry{}
+		}
+		r.pin(sst, handle)
+	}
+
+	if handle, ok := metaIndex[compressionDictBlockName]; ok {
+		if r.dict, err = r.readBlock(handle); err != nil {
+			return err
+		}
+		r.pin(sst, handle)
+	}
+
+	if handle, ok := metaIndex[rangeFilterBlockName]; ok {
+		block, err := r.readBlock(handle)
+		if err != nil {
+			return err
+		}
+		filter, ok := decodeRangeFilter(block)
+		if !ok {
+			return fmt.Errorf("corrupt range filter block")
+		}
+		r.rangeFilter = filter
+		r.pin(sst, handle)
+	}
+
+	for name, handle := range metaIndex {
+		kind := filterBlockKind(name)
+		if kind == "" {
+			continue
+		}
+		// Filters written by an unknown policy are ignored, which only costs
+		// lookups the chance to skip the table.
+		policy, ok := filterPolicyByName(strings.TrimPrefix(name, kind), sst.opts.FilterPolicy)
+		if !ok {
+			continue
+		}
+
+		block, err := r.readBlock(handle)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case filterBlockPrefix:
+			r.filter, r.filterPolicy = block, policy
+		case partitionedFilterBlockPrefix:
+			if r.filterPartitions, err = decodeIndexBlock(block); err != nil {
+				return err
+			}
+			r.filterPolicy = policy
+		case prefixFilterBlockPrefix:
+			r.prefixFilter, r.prefixPolicy = block, policy
+		}
+		r.pin(sst, handle)
+	}
+	return nil
+}
+
+// filterBlockKind returns the prefix of a filter meta block's name, or an
+// empty string for other meta blocks.
+func filterBlockKind(name string) string {
+	for _, prefix := range []string{filterBlockPrefix, partitionedFilterBlockPrefix, prefixFilterBlockPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// pin charges a meta block held by the reader to the block cache. The entry
+// has no value; lookups go to the reader's copy.
+func (r *tableReader) pin(sst *SSTable, handle blockHandle) {
+	c := sst.opts.BlockCache
+	if c == nil {
+		return
+	}
+	r.pinned = append(r.pinned, c.Insert(sst.blockCacheKey(handle.Offset), nil, handle.Size))
+}
+
+// readBlock returns the block at handle. For a mapped file it is a slice of
+// the mapping, which must not be modified.
+func (r *tableReader) readBlock(handle blockHandle) ([]byte, error) {
+	if r.mapping == nil {
+		return readBlock(r.file, r.size, handle)
+	}
+	if handle.Offset < 0 || handle.Size < 0 || handle.Offset+handle.Size > int64(len(r.mapping)) {
+		return nil, fmt.Errorf("block at offset %d out of bounds", handle.Offset)
+	}
+	end := handle.Offset + handle.Size
+	return r.mapping[handle.Offset:end:end], nil
+}
+
+// close unmaps and closes the file and takes the reader's meta blocks out of
+// the block cache.
+func (r *tableReader) close(sst *SSTable) error {
+	for _, h := range r.pinned {
+		h.Release()
+		sst.opts.BlockCache.Erase(h.Key())
+	}
+	r.pinned = nil
+	if r.mapping != nil {
+		if err := munmap(r.mapping); err != nil {
+			r.file.Close()
+			return err
+		}
+		r.mapping = nil
+	}
+	return r.file.Close()
+}
+
+// findBlock returns the position of the first of blocks that may hold key.
+func findBlock(blocks []blockIndexEntry, key string) int {
+	return sort.Search(len(blocks), func(i int) bool { return blocks[i].lastKey >= key })
+}
@@ -0,0 +1,314 @@
+package sstable
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ashmitsharp/lsm-tree/backend/internal/ratelimit"
+)
+
+// Writer builds an SSTable from entries added in key order.
+type Writer struct {
+	sstable    *SSTable
+	file       *os.File
+	writer     *bufio.Writer
+	offset     int64
+	compressor Compressor
+	block      *blockBuilder
+	lastKey    string
+	blocks     []blockIndexEntry
+	// blockHashEnds holds, for each data block, the number of hashes taken
+	// up to its last key, so filters can be partitioned by block.
+	blockHashEnds []int
+	// Blocks are held back in pending until dict has been trained on them.
+	dict         []byte
+	training     bool
+	pending      []pendingBlock
+	pendingBytes int
+	hashes       []uint64
+	// prefixHashes holds one hash per distinct prefix; lastPrefix detects
+	// repeats, which are adjacent since keys arrive sorted.
+	prefixHashes []uint64
+	lastPrefix   string
+	rangeFilter  *rangeFilterBuilder
+}
+
+func (sst *SSTable) NewWriter() (*Writer, error) {
+	file, err := os.Create(sst.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if sst.opts.BlockCache != nil {
+		sst.cacheID = sst.opts.BlockCache.NewID()
+	}
+	w := &Writer{
+		sstable:    sst,
+		file:       file,
+		writer:     bufio.NewWriter(file),
+		compressor: sst.opts.compressorForLevel(sst.level),
+		block:      newBlockBuilder(sst.opts.BlockRestartInterval),
+	}
+	if maxLength := sst.opts.RangeFilterMaxPrefixLength; maxLength > 0 {
+		w.rangeFilter = newRangeFilterBuilder(maxLength)
+	}
+	if _, ok := w.compressor.(DictCompressor); ok && sst.opts.CompressionDictSize > 0 {
+		w.training = true
+	}
+	return w, nil
+}
+
+type pendingBlock struct {
+	data    []byte
+	lastKey string
+}
+
+// SetRateLimiter throttles the writer's file writes through limiter at the
+// given priority. It must be called before the first Add; a nil limiter
+// leaves the writer unthrottled.
+func (w *Writer) SetRateLimiter(limiter *ratelimit.RateLimiter, pri ratelimit.Priority) {
+	if limiter == nil {
+		return
+	}
+	w.writer = bufio.NewWriter(&limitedWriter{w: w.file, limiter: limiter, pri: pri})
+}
+
+// SetNewestEntryTime records when the newest entry added to the table was
+// written. Tables it is not called for take their creation time.
+func (w *Writer) SetNewestEntryTime(t time.Time) {
+	w.sstable.props.NewestEntryTime = t
+}
+
+func (w *Writer) Add(entry Entry) error {
+	props := &w.sstable.props
+	if props.NumEntries > 0 && entry.Key <= props.LargestKey {
+		return fmt.Errorf("sstable: key %q added out of order after %q", entry.Key, props.LargestKey)
+	}
+
+	w.block.add(entry)
+	props.add(entry)
+	w.lastKey = entry.Key
+
+	if opts := w.sstable.opts; opts.FilterPolicy != nil {
+		w.hashes = append(w.hashes, keyHash(entry.Key))
+
+		if e := opts.PrefixExtractor; e != nil && e.InDomain(entry.Key) {
+			prefix := e.Transform(entry.Key)
+			if len(w.prefixHashes) == 0 || prefix != w.lastPrefix {
+				w.prefixHashes = append(w.prefixHashes, keyHash(prefix))
+				w.lastPrefix = prefix
+			}
+		}
+	}
+	if w.rangeFilter != nil {
+		w.rangeFilter.add(entry.Key)
+	}
+
+	if w.block.size() >= w.blockSize() {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+func (w *Writer) blockSize() int {
+	if w.sstable.opts.BlockSize > 0 {
+		return w.sstable.opts.BlockSize
+	}
+	return defaultBlockSize
+}
+
+// flushBlock ends the current data block. While a dictionary is being
+// trained the block is held back, otherwise it is written.
+func (w *Writer) flushBlock() error {
+	if w.block.empty() {
+		return nil
+	}
+	data := w.block.finish()
+	if w.sstable.opts.FilterPolicy != nil {
+		w.blockHashEnds = append(w.blockHashEnds, len(w.hashes))
+	}
+
+	if !w.training {
+		return w.writeDataBlock(data, w.lastKey)
+	}
+	w.pending = append(w.pending, pendingBlock{data: data, lastKey: w.lastKey})
+	w.pendingBytes += len(data)
+	if w.pendingBytes >= w.sstable.opts.dictTrainingBytes() {
+		return w.finishTraining()
+	}
+	return nil
+}
+
+// finishTraining trains the dictionary on the held back blocks and writes
+// them.
+func (w *Writer) finishTraining() error {
+	samples := make([][]byte, len(w.pending))
+	for i, block := range w.pending {
+		samples[i] = block.data
+	}
+	w.dict = trainDictionary(samples, w.sstable.opts.CompressionDictSize)
+	w.training = false
+
+	for _, block := range w.pending {
+		if err := w.writeDataBlock(block.data, block.lastKey); err != nil {
+			return err
+		}
+	}
+	w.pending, w.pendingBytes = nil, 0
+	return nil
+}
+
+// writeDataBlock compresses a data block, writes it and adds it to the
+// index. Blocks that compress poorly are stored as they are.
+func (w *Writer) writeDataBlock(data []byte, lastKey string) error {
+	w.sstable.props.RawDataSize += int64(len(data))
+	compression := noCompression
+	if w.compressor != nil {
+		var compressed []byte
+		var err error
+		if len(w.dict) > 0 {
+			compressed, err = w.compressor.(DictCompressor).CompressWithDict(data, w.dict)
+		} else {
+			compressed, err = w.compressor.Compress(data)
+		}
+		if err != nil {
+			return err
+		}
+		if len(compressed) < len(data)-len(data)/8 {
+			data = compressed
+			compression = w.compressor.ID()
+		}
+	}
+
+	w.blocks = append(w.blocks, blockIndexEntry{
+		lastKey:     lastKey,
+		handle:      w.writeBlock(data),
+		compression: compression,
+	})
+	return nil
+}
+
+// EstimatedSize returns the number of bytes written so far, including data
+// blocks not written yet.
+func (w *Writer) EstimatedSize() int64 {
+	return w.offset + int64(w.pendingBytes+w.block.size())
+}
+
+func (w *Writer) Empty() bool {
+	return w.sstable.props.NumEntries == 0
+}
+
+// Finish writes the last data block, the meta blocks and the footer, and
+// syncs the file.
+func (w *Writer) Finish() error {
+	if err := w.flushBlock(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if w.training {
+		if err := w.finishTraining(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+
+	opts := w.sstable.opts
+	props := &w.sstable.props
+	props.DataSize = w.offset
+	props.CreationTime = time.Now()
+	if props.NewestEntryTime.IsZero() {
+		props.NewestEntryTime = props.CreationTime
+	}
+	props.Compression = compressorName(w.compressor)
+	props.FormatVersion = formatPrefixCompressed
+	props.CompressionDictSize = len(w.dict)
+	if len(w.prefixHashes) > 0 {
+		props.PrefixExtractor = opts.PrefixExtractor.Name()
+	}
+
+	metaIndex := make(map[string]blockHandle)
+	partitioned := opts.MetadataBlockSize > 0 && len(w.blocks) > 0
+	if partitioned {
+		w.writePartitions(metaIndex)
+	} else {
+		metaIndex[indexBlockName] = w.writeBlock(encodeIndexBlock(w.blocks))
+	}
+
+	encoded, err := json.Marshal(props)
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+	metaIndex[propertiesBlockName] = w.writeBlock(encoded)
+	if len(w.dict) > 0 {
+		metaIndex[compressionDictBlockName] = w.writeBlock(w.dict)
+	}
+	if policy := opts.FilterPolicy; policy != nil && len(w.hashes) > 0 {
+		if !partitioned {
+			filter := policy.CreateFilter(w.hashes)
+			metaIndex[filterBlockPrefix+policy.Name()] = w.writeBlock(filter)
+		}
+
+		if len(w.prefixHashes) > 0 {
+			prefixFilter := policy.CreateFilter(w.prefixHashes)
+			metaIndex[prefixFilterBlockPrefix+policy.Name()] = w.writeBlock(prefixFilter)
+		}
+	}
+	if w.rangeFilter != nil {
+		filter := w.rangeFilter.finish()
+		metaIndex[rangeFilterBlockName] = w.writeBlock(filter.encode())
+	}
+
+	encoded, err = json.Marshal(metaIndex)
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+	metaIndexHandle := w.writeBlock(encoded)
+	w.writer.Write(encodeFooter(metaIndexHandle))
+	w.offset += footerSize
+
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	w.sstable.size = w.offset
+	return w.file.Close()
+}
+
+// writeBlock appends block after everything written so far. Errors are
+// sticky in the buffered writer and surface when Finish flushes it.
+func (w *Writer) writeBlock(block []byte) blockHandle {
+	handle := blockHandle{Offset: w.offset, Size: int64(len(block))}
+	w.writer.Write(block)
+	w.offset += handle.Size
+	return handle
+}
+
+// Abort closes and removes a partially written table.
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.sstable.filename)
+}
+
+// limitedWriter requests tokens for every write before passing it on. Writes
+// arrive in buffer-sized chunks, so the limiter is consulted once per chunk
+// rather than once per record.
+type limitedWriter struct {
+	w       io.Writer
+	limiter *ratelimit.RateLimiter
+	pri     ratelimit.Priority
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	lw.limiter.Request(int64(len(p)), lw.pri)
+	return lw.w.Write(p)
+}
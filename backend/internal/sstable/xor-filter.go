@@ -0,0 +1,191 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// xorFilterPolicy builds xor filters with bit-packed fingerprints. Each key
+// maps to one slot in each of three segments, and the fingerprints are
+// assigned so that the xor of a key's three slots equals its own fingerprint.
+// With f-bit fingerprints the false positive rate is 2^-f at 1.23*f bits per
+// key, against 1.44*log2(1/rate) bits per key for a bloom filter, about 15%
+// smaller at equal accuracy. Filters are immutable and building one needs all
+// keys up front, which suits tables.
+//
+// Encoded, a filter is an 8-byte seed, a 4-byte segment length, one byte of
+// fingerprint width and the packed fingerprints.
+type xorFilterPolicy struct {
+	fpRate float64
+}
+
+const xorHeaderSize = 8 + 4 + 1
+
+// NewXorFilterPolicy returns a policy building xor filters whose fingerprint
+// width is chosen for the given target false positive rate.
+func NewXorFilterPolicy(fpRate float64) FilterPolicy {
+	return xorFilterPolicy{fpRate: fpRate}
+}
+
+func (p xorFilterPolicy) Name() string {
+	return "xor"
+}
+
+func (p xorFilterPolicy) fingerprintBits() int {
+	f := int(math.Ceil(-math.Log2(p.fpRate)))
+	if f < 1 {
+		f = 1
+	}
+	if f > 32 {
+		f = 32
+	}
+	return f
+}
+
+// xorSlots returns the three slots of a key and its fingerprint.
+func xorSlots(h, seed uint64, segmentLength uint32, fpBits int) ([3]uint32, uint32) {
+	h = mix64(h + seed)
+	var slots [3]uint32
+	for i := range slots {
+		r := uint32(bits.RotateLeft64(h, 21*i))
+		slots[i] = uint32(i)*segmentLength + uint32(uint64(r)*uint64(segmentLength)>>32)
+	}
+	fingerprint := uint32(h^h>>32) & uint32(1<<fpBits-1)
+	return slots, fingerprint
+}
+
+func (p xorFilterPolicy) CreateFilter(hashes []uint64) []byte {
+	// Peeling fails on duplicate hashes, so drop them first.
+	unique := append([]uint64(nil), hashes...)
+	sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+	n := 0
+	for i, h := range unique {
+		if i == 0 || h != unique[n-1] {
+			unique[n] = h
+			n++
+		}
+	}
+	unique = unique[:n]
+
+	fpBits := p.fingerprintBits()
+	segmentLength := uint32((float64(n)*1.23+32)/3) + 1
+	capacity := 3 * segmentLength
+
+	for seed := uint64(0x9e3779b97f4a7c15); ; seed += 0x9e3779b97f4a7c15 {
+		fingerprints, ok := xorAssign(unique, seed, segmentLength, capacity, fpBits)
+		if !ok {
+			continue
+		}
+
+		filter := make([]byte, xorHeaderSize+(int(capacity)*fpBits+7)/8)
+		binary.LittleEndian.PutUint64(filter[0:], seed)
+		binary.LittleEndian.PutUint32(filter[8:], segmentLength)
+		filter[12] = byte(fpBits)
+		packed := filter[xorHeaderSize:]
+		for slot, fingerprint := range fingerprints {
+			putBits(packed, slot*fpBits, fpBits, fingerprint)
+		}
+		return filter
+	}
+}
+
+// xorAssign peels the keys off slots used by a single key, then assigns the
+// fingerprints in reverse order. It fails if peeling gets stuck, in which
+// case another seed must be tried.
+func xorAssign(hashes []uint64, seed uint64, segmentLength, capacity uint32, fpBits int) ([]uint32, bool) {
+	counts := make([]uint32, capacity)
+	xors := make([]uint64, capacity)
+	for _, h := range hashes {
+		slots, _ := xorSlots(h, seed, segmentLength, fpBits)
+		for _, slot := range slots {
+			counts[slot]++
+			xors[slot] ^= h
+		}
+	}
+
+	var queue []uint32
+	for slot, count := range counts {
+		if count == 1 {
+			queue = append(queue, uint32(slot))
+		}
+	}
+
+	type peeled struct {
+		h    uint64
+		slot uint32
+	}
+	stack := make([]peeled, 0, len(hashes))
+	for len(queue) > 0 {
+		slot := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if counts[slot] != 1 {
+			continue
+		}
+
+		h := xors[slot]
+		stack = append(stack, peeled{h: h, slot: slot})
+		slots, _ := xorSlots(h, seed, segmentLength, fpBits)
+		for _, other := range slots {
+			counts[other]--
+			xors[other] ^= h
+			if counts[other] == 1 {
+				queue = append(queue, other)
+			}
+		}
+	}
+	if len(stack) != len(hashes) {
+		return nil, false
+	}
+
+	fingerprints := make([]uint32, capacity)
+	for i := len(stack) - 1; i >= 0; i-- {
+		slots, fingerprint := xorSlots(stack[i].h, seed, segmentLength, fpBits)
+		value := fingerprint
+		for _, slot := range slots {
+			if slot != stack[i].slot {
+				value ^= fingerprints[slot]
+			}
+		}
+		fingerprints[stack[i].slot] = value
+	}
+	return fingerprints, true
+}
+
+func (p xorFilterPolicy) MayContain(filter []byte, h uint64) bool {
+	if len(filter) < xorHeaderSize {
+		return true
+	}
+	seed := binary.LittleEndian.Uint64(filter[0:])
+	segmentLength := binary.LittleEndian.Uint32(filter[8:])
+	fpBits := int(filter[12])
+	packed := filter[xorHeaderSize:]
+	if fpBits < 1 || fpBits > 32 || len(packed)*8 < int(3*segmentLength)*fpBits {
+		return true
+	}
+
+	slots, fingerprint := xorSlots(h, seed, segmentLength, fpBits)
+	for _, slot := range slots {
+		fingerprint ^= getBits(packed, int(slot)*fpBits, fpBits)
+	}
+	return fingerprint == 0
+}
+
+// putBits stores the low width bits of value at bit offset pos. Values span
+// at most five bytes since width is at most 32.
+func putBits(data []byte, pos, width int, value uint32) {
+	window := uint64(value) & (1<<width - 1) << (pos % 8)
+	for i := pos / 8; window != 0; i++ {
+		data[i] |= byte(window)
+		window >>= 8
+	}
+}
+
+func getBits(data []byte, pos, width int) uint32 {
+	var window uint64
+	for i := 0; i < 5 && pos/8+i < len(data); i++ {
+		window |= uint64(data[pos/8+i]) << (8 * i)
+	}
+	return uint32(window>>(pos%8)) & uint32(1<<width-1)
+}
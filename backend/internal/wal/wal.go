@@ -6,27 +6,94 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 )
 
+const segmentSuffix = ".log"
+
+// WAL is split into numbered segment files in a directory. Writes always go
+// to the newest segment; Rotate starts a new one when a memtable is frozen so
+// its segments can be dropped once the memtable reaches an SSTable.
 type WAL struct {
-	file   *os.File
-	writer *bufio.Writer
-	mutex  sync.Mutex
+	dir         string
+	file        *os.File
+	writer      *bufio.Writer
+	segment     uint64
+	segmentSize int64
+	closedSizes map[uint64]int64
+	mutex       sync.Mutex
 }
 
-func NewWAL(filename string) (*WAL, error) {
-	fmt.Println(filename)
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	fmt.Println("File descriptor:", file.Fd())
+func NewWAL(dir string) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %v", err)
+	}
+
+	w := &WAL{
+		dir:         dir,
+		closedSizes: make(map[uint64]int64),
+	}
+
+	segments, err := w.listSegments()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open WAL file: %v", err)
+		return nil, err
+	}
+	for _, id := range segments {
+		info, err := os.Stat(w.segmentPath(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat WAL segment %d: %v", id, err)
+		}
+		w.closedSizes[id] = info.Size()
+		w.segment = id
 	}
 
-	return &WAL{
-		file:   file,
-		writer: bufio.NewWriter(file),
-	}, nil
+	if err := w.openSegment(w.segment + 1); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *WAL) segmentPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%06d%s", id, segmentSuffix))
+}
+
+func (w *WAL) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL directory: %v", err)
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, id)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (w *WAL) openSegment(id uint64) error {
+	file, err := os.OpenFile(w.segmentPath(id), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL file: %v", err)
+	}
+
+	w.file = file
+	w.writer = bufio.NewWriter(file)
+	w.segment = id
+	w.segmentSize = 0
+	return nil
 }
 
 func (w *WAL) AppendPut(key, value string) error {
@@ -51,6 +118,7 @@ func (w *WAL) AppendPut(key, value string) error {
 		return err
 	}
 
+	w.segmentSize += int64(1 + 4 + len(key) + 4 + len(value))
 	return w.writer.Flush()
 }
 
@@ -71,9 +139,61 @@ func (w *WAL) AppendDelete(key string) error {
 		return err
 	}
 
+	w.segmentSize += int64(1 + 4 + len(key))
 	return w.writer.Flush()
 }
 
+// Rotate closes the current segment and starts a new one. It returns the id
+// of the closed segment, which can later be passed to Release. If the new
+// segment cannot be created, writes keep going to the current one.
+func (w *WAL) Rotate() (uint64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.writer.Flush(); err != nil {
+		return 0, err
+	}
+
+	closed, file, size := w.segment, w.file, w.segmentSize
+	if err := w.openSegment(closed + 1); err != nil {
+		return 0, err
+	}
+	w.closedSizes[closed] = size
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	return closed, nil
+}
+
+// Release deletes every closed segment up to and including upTo.
+func (w *WAL) Release(upTo uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for id := range w.closedSizes {
+		if id > upTo {
+			continue
+		}
+		if err := os.Remove(w.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove WAL segment %d: %v", id, err)
+		}
+		delete(w.closedSizes, id)
+	}
+	return nil
+}
+
+// TotalSize returns the size of all live segments, including the current one.
+func (w *WAL) TotalSize() int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	total := w.segmentSize
+	for _, size := range w.closedSizes {
+		total += size
+	}
+	return total
+}
+
 func (w *WAL) Close() error {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
@@ -84,48 +204,49 @@ func (w *WAL) Close() error {
 	return w.file.Close()
 }
 
+// Replay applies the entries of every closed segment in order. The current
+// segment is always new at the time of recovery and is skipped.
 func (w *WAL) Replay(applyFunc func(opType uint8, key, value string) error) error {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	// Check if the file is empty
-	info, err := w.file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get WAL file info: %v", err)
+	segments := make([]uint64, 0, len(w.closedSizes))
+	for id := range w.closedSizes {
+		segments = append(segments, id)
 	}
-	if info.Size() == 0 {
-		fmt.Println("WAL file is empty")
-		return nil
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+
+	for _, id := range segments {
+		if err := w.replaySegment(id, applyFunc); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Seek to the beginning of the file
-	_, err = w.file.Seek(0, 0)
+func (w *WAL) replaySegment(id uint64, applyFunc func(opType uint8, key, value string) error) error {
+	file, err := os.Open(w.segmentPath(id))
 	if err != nil {
-		return fmt.Errorf("failed to seek WAL file: %v", err)
+		return fmt.Errorf("failed to open WAL segment %d: %v", id, err)
 	}
+	defer file.Close()
 
-	reader := bufio.NewReader(w.file)
-	fmt.Printf("WAL file descriptor: %d\n", w.file.Fd())
+	reader := bufio.NewReader(file)
 
 	for {
 		opType, err := reader.ReadByte()
 		if err != nil {
 			if err == io.EOF {
-				fmt.Println("Reached end of WAL file")
 				break
 			}
 			return fmt.Errorf("failed to read operation type from WAL: %v", err)
 		}
 
-		fmt.Printf("Read operation type: %d\n", opType)
-
 		var keyLen uint32
 		if err := binary.Read(reader, binary.LittleEndian, &keyLen); err != nil {
 			return fmt.Errorf("failed to read key length from WAL: %v", err)
 		}
 
-		fmt.Printf("Key length: %d\n", keyLen)
-
 		keyBytes := make([]byte, keyLen)
 		n, err := io.ReadFull(reader, keyBytes)
 		if err != nil {
@@ -133,7 +254,6 @@ func (w *WAL) Replay(applyFunc func(opType uint8, key, value string) error) erro
 		}
 
 		key := string(keyBytes)
-		fmt.Printf("Read key: %s\n", key)
 
 		var value string
 		if opType == 1 { // Put operation
@@ -142,15 +262,12 @@ func (w *WAL) Replay(applyFunc func(opType uint8, key, value string) error) erro
 				return fmt.Errorf("failed to read value length from WAL: %v", err)
 			}
 
-			fmt.Printf("Value length: %d\n", valueLen)
-
 			valueBytes := make([]byte, valueLen)
 			n, err := io.ReadFull(reader, valueBytes)
 			if err != nil {
 				return fmt.Errorf("failed to read value from WAL (read %d bytes): %v", n, err)
 			}
 			value = string(valueBytes)
-			fmt.Printf("Read value: %s\n", value)
 		}
 
 		if err := applyFunc(opType, key, value); err != nil {
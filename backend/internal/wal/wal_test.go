@@ -0,0 +1,110 @@
+package wal
+
+import (
+	"os"
+	"testing"
+)
+
+type record struct {
+	opType     uint8
+	key, value string
+}
+
+func replayAll(t *testing.T, dir string) []record {
+	t.Helper()
+	w, err := NewWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	var records []record
+	err = w.Replay(func(opType uint8, key, value string) error {
+		records = append(records, record{opType, key, value})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestRotateAndRelease(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AppendPut("a", "1")
+	first, err := w.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AppendDelete("b")
+	second, err := w.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AppendPut("c", "3")
+	if second <= first {
+		t.Fatalf("segment ids %d then %d", first, second)
+	}
+	if size := w.TotalSize(); size == 0 {
+		t.Fatal("total size of three written segments is zero")
+	}
+
+	if err := w.Release(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The segment released is gone; the others replay in order.
+	want := []record{{2, "b", ""}, {1, "c", "3"}}
+	got := replayAll(t, dir)
+	if len(got) != len(want) {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("replayed %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFailedRotateKeepsCurrentSegment(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.AppendPut("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in place of the next segment keeps it from being created.
+	blocker := w.segmentPath(w.segment + 1)
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Rotate(); err == nil {
+		t.Fatal("rotate over a blocked segment succeeded")
+	}
+	if err := w.AppendPut("b", "2"); err != nil {
+		t.Fatalf("append after a failed rotate: %v", err)
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := replayAll(t, dir); len(got) != 2 || got[1].key != "b" {
+		t.Fatalf("replayed %v, want both writes", got)
+	}
+}